@@ -0,0 +1,488 @@
+// Package diff compares two OpenAPI documents, an older and a newer version of the
+// same API, and sorts what changed into breaking and non-breaking.
+//
+// Whether a change breaks clients depends on which way the data flows. A request is
+// written by the client, so the API accepting less than it used to is breaking. A
+// response is read by the client, so the API sending more than it used to is.
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Change is one difference between the two documents.
+type Change struct {
+	// Path is a JSON pointer to what changed, in the newer document, or the older one
+	// for something that was removed.
+	Path string
+	Kind string
+	// Breaking is whether a client written against the older document could fail
+	// against the newer one.
+	Breaking bool
+}
+
+const (
+	// ChangeAdded is a path, operation, status, parameter, media type or field that's new.
+	ChangeAdded = "added"
+	// ChangeRemoved is one that's gone.
+	ChangeRemoved = "removed"
+	// ChangeType is a type that now allows more or fewer kinds of values.
+	ChangeType = "type"
+	// ChangeFormat is a format that was added, dropped or changed.
+	ChangeFormat = "format"
+	// ChangeEnum is an enum that gained or lost values.
+	ChangeEnum = "enum"
+	// ChangeRequired is a field, parameter or body that became required.
+	ChangeRequired = "required"
+	// ChangeOptional is one that's no longer required.
+	ChangeOptional = "optional"
+)
+
+func (c Change) String() string {
+	if c.Breaking {
+		return "breaking " + c.Kind + " " + c.Path
+	}
+	return "non-breaking " + c.Kind + " " + c.Path
+}
+
+// Breaking returns the breaking changes in cs.
+func Breaking(cs []Change) []Change {
+	var res []Change
+	for _, c := range cs {
+		if c.Breaking {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// LoadFile reads an OpenAPI 3 document, json or yaml, with its refs resolved.
+func LoadFile(fileName string) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("could not load %s: %w", fileName, err)
+	}
+	return doc, nil
+}
+
+// Docs returns what changed from a to b, in document order.
+func Docs(a, b *openapi3.T) []Change {
+	d := &differ{seen: make(map[[2]*openapi3.Schema]bool)}
+	d.in(func() { d.paths(a.Paths, b.Paths) }, "paths")
+	return d.changes
+}
+
+// direction is which way a schema's values flow.
+type direction int
+
+const (
+	request direction = iota
+	response
+)
+
+// breaks reports whether a schema accepting fewer or more values than it used to
+// breaks clients.
+func (dir direction) breaks(narrower, wider bool) bool {
+	if dir == request {
+		return narrower
+	}
+	return wider
+}
+
+type differ struct {
+	changes []Change
+	path    []string
+	// seen stops recursive schemas, refs resolved by the loader can form cycles
+	seen map[[2]*openapi3.Schema]bool
+}
+
+func (d *differ) in(f func(), tokens ...string) {
+	n := len(d.path)
+	d.path = append(d.path, tokens...)
+	f()
+	d.path = d.path[:n]
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func (d *differ) change(kind string, breaking bool, tokens ...string) {
+	var b strings.Builder
+	for _, t := range append(d.path[:len(d.path):len(d.path)], tokens...) {
+		b.WriteString("/")
+		b.WriteString(pointerEscaper.Replace(t))
+	}
+	d.changes = append(d.changes, Change{Path: b.String(), Kind: kind, Breaking: breaking})
+}
+
+// paths matches paths up by their shape, /users/{id} and /users/{userId} are the same
+// path.
+func (d *differ) paths(a, b openapi3.Paths) {
+	as := make(map[string]string, len(a))
+	for k := range a {
+		as[pathShape(k)] = k
+	}
+	bs := make(map[string]string, len(b))
+	for k := range b {
+		bs[pathShape(k)] = k
+	}
+
+	for _, k := range sortedKeys(a) {
+		w, in := bs[pathShape(k)]
+		if !in {
+			d.change(ChangeRemoved, true, k)
+			continue
+		}
+		d.in(func() { d.pathItem(a[k], b[w]) }, w)
+	}
+	for _, k := range sortedKeys(b) {
+		if _, in := as[pathShape(k)]; !in {
+			d.change(ChangeAdded, false, k)
+		}
+	}
+}
+
+func pathShape(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			parts[i] = "{}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func (d *differ) pathItem(a, b *openapi3.PathItem) {
+	if a == nil || b == nil {
+		return
+	}
+
+	d.in(func() { d.parameters(a.Parameters, b.Parameters) }, "parameters")
+
+	aops, bops := a.Operations(), b.Operations()
+	for _, method := range sortedKeys(aops) {
+		token := strings.ToLower(method)
+		if bop, in := bops[method]; in {
+			d.in(func() { d.operation(aops[method], bop) }, token)
+		} else {
+			d.change(ChangeRemoved, true, token)
+		}
+	}
+	for _, method := range sortedKeys(bops) {
+		if _, in := aops[method]; !in {
+			d.change(ChangeAdded, false, strings.ToLower(method))
+		}
+	}
+}
+
+func (d *differ) operation(a, b *openapi3.Operation) {
+	d.in(func() { d.parameters(a.Parameters, b.Parameters) }, "parameters")
+	d.in(func() { d.requestBody(a.RequestBody, b.RequestBody) }, "requestBody")
+	d.in(func() { d.responses(a.Responses, b.Responses) }, "responses")
+}
+
+// parameters matches parameters up by where they are and their name. The server no
+// longer reading one isn't breaking, it needing a new one is.
+func (d *differ) parameters(a, b openapi3.Parameters) {
+	as := make(map[string]*openapi3.Parameter, len(a))
+	for _, p := range a {
+		if p.Value != nil {
+			as[p.Value.In+" "+p.Value.Name] = p.Value
+		}
+	}
+	bs := make(map[string]*openapi3.Parameter, len(b))
+	for _, p := range b {
+		if p.Value != nil {
+			bs[p.Value.In+" "+p.Value.Name] = p.Value
+		}
+	}
+
+	for i, p := range a {
+		if p.Value == nil {
+			continue
+		}
+		if _, in := bs[p.Value.In+" "+p.Value.Name]; !in {
+			d.change(ChangeRemoved, false, strconv.Itoa(i))
+		}
+	}
+	for i, p := range b {
+		if p.Value == nil {
+			continue
+		}
+		q, in := as[p.Value.In+" "+p.Value.Name]
+		if !in {
+			d.change(ChangeAdded, p.Value.Required, strconv.Itoa(i))
+			continue
+		}
+		d.in(func() {
+			d.required(q.Required, p.Value.Required, request)
+			d.in(func() { d.schema(q.Schema, p.Value.Schema, request) }, "schema")
+			d.in(func() { d.content(q.Content, p.Value.Content, request) }, "content")
+		}, strconv.Itoa(i))
+	}
+}
+
+// required records a field becoming required or optional. The client has to start
+// sending what's required in a request, and can no longer count on what's optional in
+// a response.
+func (d *differ) required(a, b bool, dir direction, tokens ...string) {
+	if !a && b {
+		d.change(ChangeRequired, dir == request, tokens...)
+	}
+	if a && !b {
+		d.change(ChangeOptional, dir == response, tokens...)
+	}
+}
+
+func (d *differ) requestBody(a, b *openapi3.RequestBodyRef) {
+	if a == nil && b == nil {
+		return
+	}
+	if a == nil {
+		d.change(ChangeAdded, b.Value != nil && b.Value.Required)
+		return
+	}
+	if b == nil {
+		d.change(ChangeRemoved, false)
+		return
+	}
+	if a.Value == nil || b.Value == nil {
+		return
+	}
+
+	d.required(a.Value.Required, b.Value.Required, request)
+	d.in(func() { d.content(a.Value.Content, b.Value.Content, request) }, "content")
+}
+
+// content compares the media types on both sides. One that's gone breaks clients
+// either way, whether they were sending it or expecting it back.
+func (d *differ) content(a, b openapi3.Content, dir direction) {
+	for _, k := range sortedKeys(a) {
+		w, in := b[k]
+		if !in {
+			d.change(ChangeRemoved, true, k)
+			continue
+		}
+		if a[k] != nil && w != nil {
+			d.in(func() { d.schema(a[k].Schema, w.Schema, dir) }, k, "schema")
+		}
+	}
+	for _, k := range sortedKeys(b) {
+		if _, in := a[k]; !in {
+			d.change(ChangeAdded, false, k)
+		}
+	}
+}
+
+func (d *differ) responses(a, b openapi3.Responses) {
+	for _, k := range sortedKeys(a) {
+		w, in := b[k]
+		if !in {
+			d.change(ChangeRemoved, true, k)
+			continue
+		}
+		if a[k].Value != nil && w.Value != nil {
+			d.in(func() { d.response(a[k].Value, w.Value) }, k)
+		}
+	}
+	for _, k := range sortedKeys(b) {
+		if _, in := a[k]; !in {
+			d.change(ChangeAdded, false, k)
+		}
+	}
+}
+
+func (d *differ) response(a, b *openapi3.Response) {
+	d.in(func() {
+		for _, k := range sortedKeys(a.Headers) {
+			w, in := b.Headers[k]
+			if !in {
+				d.change(ChangeRemoved, true, k)
+				continue
+			}
+			if a.Headers[k].Value != nil && w.Value != nil {
+				d.in(func() { d.schema(a.Headers[k].Value.Schema, w.Value.Schema, response) }, k, "schema")
+			}
+		}
+		for _, k := range sortedKeys(b.Headers) {
+			if _, in := a.Headers[k]; !in {
+				d.change(ChangeAdded, false, k)
+			}
+		}
+	}, "headers")
+	d.in(func() { d.content(a.Content, b.Content, response) }, "content")
+}
+
+func (d *differ) schema(a, b *openapi3.SchemaRef, dir direction) {
+	if a == nil || b == nil || a.Value == nil || b.Value == nil {
+		return
+	}
+	sa, sb := a.Value, b.Value
+	if d.seen[[2]*openapi3.Schema{sa, sb}] {
+		return
+	}
+	d.seen[[2]*openapi3.Schema{sa, sb}] = true
+
+	// a format only means something for the type it's on
+	if narrower, wider := compareTypes(sa, sb); narrower || wider {
+		d.change(ChangeType, dir.breaks(narrower, wider), "type")
+	} else if sa.Format != sb.Format {
+		d.change(ChangeFormat, dir.breaks(sb.Format != "", sa.Format != ""), "format")
+	}
+	if narrower, wider := compareEnums(sa.Enum, sb.Enum); narrower || wider {
+		d.change(ChangeEnum, dir.breaks(narrower, wider), "enum")
+	}
+
+	d.in(func() { d.properties(sa, sb, dir) }, "properties")
+	d.in(func() { d.schema(sa.Items, sb.Items, dir) }, "items")
+	d.in(func() {
+		d.schema(sa.AdditionalProperties.Schema, sb.AdditionalProperties.Schema, dir)
+	}, "additionalProperties")
+	d.in(func() { d.branches(sa.OneOf, sb.OneOf, dir) }, "oneOf")
+	d.in(func() { d.branches(sa.AnyOf, sb.AnyOf, dir) }, "anyOf")
+}
+
+// properties compares the fields of two objects. A field that's gone breaks clients
+// reading it, one that's new and required breaks clients that don't send it.
+func (d *differ) properties(a, b *openapi3.Schema, dir direction) {
+	for _, k := range sortedKeys(a.Properties) {
+		w, in := b.Properties[k]
+		if !in {
+			d.change(ChangeRemoved, dir == response, k)
+			continue
+		}
+		d.required(isRequired(a, k), isRequired(b, k), dir, k)
+		d.in(func() { d.schema(a.Properties[k], w, dir) }, k)
+	}
+	for _, k := range sortedKeys(b.Properties) {
+		if _, in := a.Properties[k]; !in {
+			d.change(ChangeAdded, dir == request && isRequired(b, k), k)
+		}
+	}
+}
+
+func isRequired(s *openapi3.Schema, name string) bool {
+	for _, r := range s.Required {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// branches compares the branches of a oneOf by their type, the types themselves were
+// compared already.
+func (d *differ) branches(a, b openapi3.SchemaRefs, dir direction) {
+	for i, r := range b {
+		if r.Value == nil || r.Value.Type == "" {
+			continue
+		}
+		for _, q := range a {
+			if q.Value != nil && q.Value.Type == r.Value.Type {
+				d.in(func() { d.schema(q, r, dir) }, strconv.Itoa(i))
+				break
+			}
+		}
+	}
+}
+
+// compareTypes reports whether b allows fewer kinds of values than a, more, or both.
+func compareTypes(a, b *openapi3.Schema) (narrower, wider bool) {
+	ta, tb := typeSet(a), typeSet(b)
+	if ta == nil && tb == nil {
+		return false, false
+	}
+	if ta == nil {
+		return true, false
+	}
+	if tb == nil {
+		return false, true
+	}
+	for t := range ta {
+		if !coversType(tb, t) {
+			narrower = true
+		}
+	}
+	for t := range tb {
+		if !coversType(ta, t) {
+			wider = true
+		}
+	}
+	return narrower, wider
+}
+
+// typeSet is the types s allows, with null for nullable. Nil means any type at all.
+func typeSet(s *openapi3.Schema) map[string]bool {
+	ts := make(map[string]bool)
+	if s.Type != "" {
+		ts[s.Type] = true
+	} else {
+		for _, rs := range []openapi3.SchemaRefs{s.OneOf, s.AnyOf} {
+			for _, r := range rs {
+				if r.Value == nil || r.Value.Type == "" {
+					return nil
+				}
+				ts[r.Value.Type] = true
+			}
+		}
+		if len(ts) == 0 && !s.Nullable {
+			return nil
+		}
+	}
+	if s.Nullable {
+		ts["null"] = true
+	}
+	return ts
+}
+
+func coversType(ts map[string]bool, t string) bool {
+	return ts[t] || (t == openapi3.TypeInteger && ts[openapi3.TypeNumber])
+}
+
+// compareEnums reports whether b allows fewer values than a, more, or both. No enum
+// allows any value.
+func compareEnums(a, b []interface{}) (narrower, wider bool) {
+	if len(a) == 0 && len(b) == 0 {
+		return false, false
+	}
+	if len(a) == 0 {
+		return true, false
+	}
+	if len(b) == 0 {
+		return false, true
+	}
+	for _, v := range a {
+		if !containsValue(b, v) {
+			narrower = true
+		}
+	}
+	for _, v := range b {
+		if !containsValue(a, v) {
+			wider = true
+		}
+	}
+	return narrower, wider
+}
+
+func containsValue(vs []interface{}, v interface{}) bool {
+	for _, w := range vs {
+		if reflect.DeepEqual(v, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
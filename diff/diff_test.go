@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+func object(required []string, props map[string]*openapi3.Schema) *openapi3.Schema {
+	s := &openapi3.Schema{Type: openapi3.TypeObject, Required: required, Properties: openapi3.Schemas{}}
+	for k, v := range props {
+		s.Properties[k] = v.NewRef()
+	}
+	return s
+}
+
+func jsonContent(s *openapi3.Schema) openapi3.Content {
+	return openapi3.Content{"application/json": {Schema: s.NewRef()}}
+}
+
+func doc(path string, op *openapi3.Operation) *openapi3.T {
+	return &openapi3.T{Paths: openapi3.Paths{path: {Post: op}}}
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	op := &openapi3.Operation{Responses: openapi3.Responses{"200": {Value: &openapi3.Response{
+		Content: jsonContent(object(nil, map[string]*openapi3.Schema{"id": openapi3.NewIntegerSchema()})),
+	}}}}
+	assert.Empty(t, Docs(doc("/users/{id}", op), doc("/users/{userId}", op)))
+}
+
+func TestDiffResponses(t *testing.T) {
+	a := doc("/users", &openapi3.Operation{Responses: openapi3.Responses{
+		"200": {Value: &openapi3.Response{Content: jsonContent(object([]string{"id"}, map[string]*openapi3.Schema{
+			"id":    openapi3.NewIntegerSchema(),
+			"email": openapi3.NewStringSchema(),
+			"age":   openapi3.NewFloat64Schema(),
+		}))}},
+		"404": {Value: openapi3.NewResponse()},
+	}})
+	b := doc("/users", &openapi3.Operation{Responses: openapi3.Responses{
+		"200": {Value: &openapi3.Response{Content: jsonContent(object(nil, map[string]*openapi3.Schema{
+			"id":   openapi3.NewFloat64Schema(),
+			"age":  openapi3.NewIntegerSchema(),
+			"name": openapi3.NewStringSchema(),
+		}))}},
+		"201": {Value: openapi3.NewResponse()},
+	}})
+
+	props := "/paths/~1users/post/responses/200/content/application~1json/schema/properties"
+	assert.Equal(t, []Change{
+		{Path: props + "/age/type", Kind: ChangeType, Breaking: false},
+		{Path: props + "/email", Kind: ChangeRemoved, Breaking: true},
+		{Path: props + "/id", Kind: ChangeOptional, Breaking: true},
+		{Path: props + "/id/type", Kind: ChangeType, Breaking: true},
+		{Path: props + "/name", Kind: ChangeAdded, Breaking: false},
+		{Path: "/paths/~1users/post/responses/404", Kind: ChangeRemoved, Breaking: true},
+		{Path: "/paths/~1users/post/responses/201", Kind: ChangeAdded, Breaking: false},
+	}, Docs(a, b))
+}
+
+func TestDiffRequests(t *testing.T) {
+	a := doc("/users", &openapi3.Operation{
+		Parameters: openapi3.Parameters{{Value: openapi3.NewQueryParameter("page").WithSchema(openapi3.NewIntegerSchema())}},
+		RequestBody: &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithContent(jsonContent(
+			object(nil, map[string]*openapi3.Schema{
+				"name": openapi3.NewStringSchema(),
+				"role": openapi3.NewStringSchema(),
+				"age":  openapi3.NewFloat64Schema(),
+			}),
+		))},
+	})
+	b := doc("/users", &openapi3.Operation{
+		Parameters: openapi3.Parameters{
+			{Value: openapi3.NewQueryParameter("page").WithSchema(openapi3.NewFloat64Schema())},
+			{Value: openapi3.NewQueryParameter("tenant").WithRequired(true)},
+		},
+		RequestBody: &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithContent(jsonContent(
+			object([]string{"email"}, map[string]*openapi3.Schema{
+				"name":  openapi3.NewStringSchema(),
+				"role":  openapi3.NewStringSchema().WithEnum("admin", "member"),
+				"email": openapi3.NewStringSchema(),
+			}),
+		))},
+	})
+
+	props := "/paths/~1users/post/requestBody/content/application~1json/schema/properties"
+	assert.Equal(t, []Change{
+		{Path: "/paths/~1users/post/parameters/0/schema/type", Kind: ChangeType, Breaking: false},
+		{Path: "/paths/~1users/post/parameters/1", Kind: ChangeAdded, Breaking: true},
+		{Path: props + "/age", Kind: ChangeRemoved, Breaking: false},
+		{Path: props + "/role/enum", Kind: ChangeEnum, Breaking: true},
+		{Path: props + "/email", Kind: ChangeAdded, Breaking: true},
+	}, Docs(a, b))
+}
+
+func TestDiffRecursiveSchema(t *testing.T) {
+	node := object(nil, map[string]*openapi3.Schema{"id": openapi3.NewIntegerSchema()})
+	node.Properties["children"] = openapi3.NewArraySchema().WithItems(node).NewRef()
+	op := &openapi3.Operation{Responses: openapi3.Responses{"200": {Value: &openapi3.Response{Content: jsonContent(node)}}}}
+
+	assert.Empty(t, Docs(doc("/tree", op), doc("/tree", op)))
+}
+
+func TestDiffFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		f := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(f, []byte(body), 0o644))
+		return f
+	}
+	a, err := LoadFile(write("a.yaml", `
+openapi: 3.0.0
+info: {title: users, version: "1"}
+paths:
+  /users:
+    get:
+      responses:
+        "200": {description: ok}
+  /health:
+    get:
+      responses:
+        "200": {description: ok}
+`))
+	assert.Nil(t, err)
+	b, err := LoadFile(write("b.yaml", `
+openapi: 3.0.0
+info: {title: users, version: "2"}
+paths:
+  /users:
+    get:
+      responses:
+        "200": {description: ok}
+    delete:
+      responses:
+        "204": {description: gone}
+`))
+	assert.Nil(t, err)
+
+	cs := Docs(a, b)
+	assert.Equal(t, []Change{
+		{Path: "/paths/~1health", Kind: ChangeRemoved, Breaking: true},
+		{Path: "/paths/~1users/delete", Kind: ChangeAdded, Breaking: false},
+	}, cs)
+	assert.Len(t, Breaking(cs), 1)
+}
@@ -0,0 +1,331 @@
+package httpassembly
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/reassembly"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+var clientPreface = []byte(http2.ClientPreface)
+
+const (
+	frameHeaderLen = 9
+	// maxFrameLen is the largest frame the protocol allows, peers may have agreed to
+	// anything up to it without us seeing the settings.
+	maxFrameLen = 1<<24 - 1
+	// maxDynamicTableSize is as large as we allow either peer to grow its hpack table.
+	maxDynamicTableSize = 1 << 20
+)
+
+// isClientPreface reports whether buf starts with the connection preface a client
+// sends before speaking HTTP/2 with prior knowledge. It returns errIncomplete when
+// there aren't enough bytes to tell.
+func isClientPreface(buf []byte) (bool, error) {
+	if len(buf) < len(clientPreface) && bytes.HasPrefix(clientPreface, buf) {
+		return false, errIncomplete
+	}
+	return bytes.HasPrefix(buf, clientPreface), nil
+}
+
+// isH2CUpgrade reports whether req asks to upgrade the connection to h2c.
+func isH2CUpgrade(req []byte) bool {
+	r, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(req)))
+	if err != nil {
+		return false
+	}
+	for _, v := range strings.Split(r.Header.Get("Upgrade"), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), "h2c") {
+			return true
+		}
+	}
+	return false
+}
+
+// h2conn demultiplexes an HTTP/2 connection. Every completed stream is turned into an
+// HTTP/1.1 style request and response so it can go through HttpStream like any other.
+type h2conn struct {
+	client  reassembly.TCPFlowDirection
+	sides   map[reassembly.TCPFlowDirection]*h2side
+	streams map[uint32]*h2stream
+}
+
+type h2side struct {
+	reader  frameReader
+	framer  *http2.Framer
+	decoder *hpack.Decoder
+	// block is the header block being sent, its CONTINUATION frames follow right after
+	block []byte
+}
+
+type h2stream struct {
+	req       h2message
+	res       h2message
+	reqStarts int64
+	// upgrade is the HTTP/1.1 request that started stream 1 of an h2c upgrade
+	upgrade []byte
+}
+
+type h2message struct {
+	headers []hpack.HeaderField
+	body    []byte
+	ended   bool // END_STREAM seen, possibly still waiting on CONTINUATION
+	done    bool
+}
+
+func newH2Conn(client reassembly.TCPFlowDirection) *h2conn {
+	c := &h2conn{
+		client:  client,
+		sides:   map[reassembly.TCPFlowDirection]*h2side{},
+		streams: map[uint32]*h2stream{},
+	}
+	for _, dir := range []reassembly.TCPFlowDirection{true, false} {
+		hs := &h2side{decoder: hpack.NewDecoder(4096, nil)}
+		hs.decoder.SetAllowedMaxDynamicTableSize(maxDynamicTableSize)
+		hs.framer = http2.NewFramer(io.Discard, &hs.reader)
+		hs.framer.SetMaxReadFrameSize(maxFrameLen)
+		// we often join a connection part way through, be lenient about ordering
+		hs.framer.AllowIllegalReads = true
+		c.sides[dir] = hs
+	}
+	return c
+}
+
+// frameReader hands the framer exactly one frame at a time.
+type frameReader struct {
+	buf []byte
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// reassembleH2 handles every complete frame at the start of lhs.buffer.
+func (s *streamWrapper) reassembleH2(lhs *side, dir reassembly.TCPFlowDirection, when int64) {
+	c := s.h2
+	hs := c.sides[dir]
+
+	if dir == c.client {
+		// the client sends the preface again after an h2c upgrade
+		isPreface, err := isClientPreface(lhs.buffer)
+		if err != nil {
+			return
+		}
+		if isPreface {
+			lhs.consume(len(clientPreface), when)
+		}
+	}
+
+	for len(lhs.buffer) >= frameHeaderLen {
+		n := frameHeaderLen + int(uint32(lhs.buffer[0])<<16|uint32(lhs.buffer[1])<<8|uint32(lhs.buffer[2]))
+		if len(lhs.buffer) < n {
+			s.Log.Debug("waiting for more frame data", "have", len(lhs.buffer), "want", n)
+			return
+		}
+
+		hs.reader.buf = lhs.buffer[:n]
+		f, err := hs.framer.ReadFrame()
+		lhs.consume(n, when)
+		if err != nil {
+			s.Log.Warn("dropped unreadable frame", "err", err)
+			continue
+		}
+
+		s.reassembledFrame(f, dir, when)
+	}
+}
+
+func (s *streamWrapper) reassembledFrame(f http2.Frame, dir reassembly.TCPFlowDirection, when int64) {
+	c := s.h2
+	id := f.Header().StreamID
+	if id == 0 {
+		// connection level frames don't tell us anything about requests
+		return
+	}
+
+	// Every header block goes through the decoder, even on streams we don't follow,
+	// since it can add to the dynamic table later blocks refer to.
+	hs := c.sides[dir]
+	var fields []hpack.HeaderField
+	decoded := false
+	switch f := f.(type) {
+	case *http2.HeadersFrame:
+		hs.block = append(hs.block, f.HeaderBlockFragment()...)
+		decoded = f.HeadersEnded()
+	case *http2.PushPromiseFrame:
+		hs.block = append(hs.block, f.HeaderBlockFragment()...)
+		decoded = f.HeadersEnded()
+	case *http2.ContinuationFrame:
+		hs.block = append(hs.block, f.HeaderBlockFragment()...)
+		decoded = f.HeadersEnded()
+	}
+	if decoded {
+		var err error
+		fields, err = hs.decoder.DecodeFull(hs.block)
+		hs.block = nil
+		if err != nil {
+			// the hpack table is probably out of sync now, nothing more we can do here
+			s.Log.Warn("dropped undecodable headers", "err", err, "h2stream", id)
+			delete(c.streams, id)
+			return
+		}
+	}
+
+	fromClient := dir == c.client
+	st, in := c.streams[id]
+	if !in {
+		if !fromClient {
+			// either server push or a stream we joined part way through
+			return
+		}
+		st = &h2stream{reqStarts: when}
+		c.streams[id] = st
+	}
+
+	m := &st.res
+	if fromClient {
+		m = &st.req
+	}
+
+	switch f := f.(type) {
+	case *http2.HeadersFrame:
+		m.ended = m.ended || f.StreamEnded()
+		if decoded {
+			reassembledHeaders(m, fields)
+		}
+	case *http2.ContinuationFrame:
+		if decoded {
+			reassembledHeaders(m, fields)
+		}
+	case *http2.DataFrame:
+		m.body = append(m.body, f.Data()...)
+		if f.StreamEnded() {
+			m.done = true
+		}
+	case *http2.RSTStreamFrame:
+		delete(c.streams, id)
+		return
+	default:
+		return
+	}
+
+	if st.res.done {
+		s.reassembledH2Stream(st, id, when)
+	}
+}
+
+func reassembledHeaders(m *h2message, fields []hpack.HeaderField) {
+	if m.headers == nil && !isInformational(fields) {
+		m.headers = fields
+	}
+	// anything after the first block is trailers, which we don't track
+
+	if m.ended {
+		m.done = true
+	}
+}
+
+func (s *streamWrapper) reassembledH2Stream(st *h2stream, id uint32, when int64) {
+	delete(s.h2.streams, id)
+
+	var req []byte
+	switch {
+	case st.upgrade != nil:
+		req = st.upgrade
+	case st.req.headers != nil:
+		req = st.req.request()
+	default:
+		s.Log.Debug("dropped rr", "h2stream", id)
+		return
+	}
+
+	if st.res.headers == nil {
+		s.Log.Debug("dropped rr", "h2stream", id)
+		return
+	}
+
+	s.Log.Debug("handled rr", "h2stream", id)
+
+	// should be in seconds
+	duration := float64(when-st.reqStarts) / 1000.0
+	s.wrap.ReassembledRequestResponse(req, st.res.response(), duration)
+}
+
+func isInformational(fields []hpack.HeaderField) bool {
+	for _, f := range fields {
+		if f.Name == ":status" {
+			return strings.HasPrefix(f.Value, "1")
+		}
+	}
+	return false
+}
+
+// request formats the stream's request the way an HTTP/1.1 client would have sent it.
+func (m *h2message) request() []byte {
+	var method, path, authority string
+	for _, f := range m.headers {
+		switch f.Name {
+		case ":method":
+			method = f.Value
+		case ":path":
+			path = f.Value
+		case ":authority":
+			authority = f.Value
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %s HTTP/2.0\r\n", method, path)
+	if authority != "" {
+		fmt.Fprintf(buf, "Host: %s\r\n", authority)
+	}
+	m.writeHeaders(buf, authority != "")
+	return buf.Bytes()
+}
+
+// response formats the stream's response the way an HTTP/1.1 server would have sent it.
+func (m *h2message) response() []byte {
+	status := 0
+	for _, f := range m.headers {
+		if f.Name == ":status" {
+			status, _ = strconv.Atoi(f.Value)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "HTTP/2.0 %d %s\r\n", status, http.StatusText(status))
+	m.writeHeaders(buf, false)
+	return buf.Bytes()
+}
+
+func (m *h2message) writeHeaders(buf *bytes.Buffer, skipHost bool) {
+	for _, f := range m.headers {
+		if strings.HasPrefix(f.Name, ":") {
+			continue
+		}
+		switch f.Name {
+		case "content-length", "transfer-encoding", "connection":
+			// the body is already whole, we say how long it is below
+			continue
+		case "host":
+			if skipHost {
+				continue
+			}
+		}
+		fmt.Fprintf(buf, "%s: %s\r\n", f.Name, f.Value)
+	}
+	fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n", len(m.body))
+	buf.Write(m.body)
+}
@@ -0,0 +1,135 @@
+package httpassembly
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+type h2writer struct {
+	buf    bytes.Buffer
+	framer *http2.Framer
+	hbuf   bytes.Buffer
+	enc    *hpack.Encoder
+}
+
+func newH2Writer() *h2writer {
+	w := &h2writer{}
+	w.framer = http2.NewFramer(&w.buf, nil)
+	w.enc = hpack.NewEncoder(&w.hbuf)
+	return w
+}
+
+func (w *h2writer) headers(id uint32, end bool, fields ...string) {
+	w.hbuf.Reset()
+	for i := 0; i < len(fields); i += 2 {
+		_ = w.enc.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]})
+	}
+	_ = w.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      id,
+		BlockFragment: w.hbuf.Bytes(),
+		EndStream:     end,
+		EndHeaders:    true,
+	})
+}
+
+func (w *h2writer) data(id uint32, end bool, data string) {
+	_ = w.framer.WriteData(id, end, []byte(data))
+}
+
+func (w *h2writer) flush() string {
+	s := w.buf.String()
+	w.buf.Reset()
+	return s
+}
+
+func TestReassembleH2PriorKnowledge(t *testing.T) {
+	s, rec := newTestStream()
+	client := newH2Writer()
+	server := newH2Writer()
+
+	_ = client.framer.WriteSettings()
+	client.headers(1, false, ":method", "POST", ":path", "/users", ":authority", "x", "content-type", "application/json")
+	client.headers(3, true, ":method", "GET", ":path", "/users/1", ":authority", "x")
+	client.data(1, true, `{"a":1}`)
+	feed(s, true, http2.ClientPreface+client.flush())
+
+	_ = server.framer.WriteSettings()
+	server.headers(3, false, ":status", "200", "content-type", "application/json")
+	server.headers(1, true, ":status", "201")
+	server.data(3, true, `{"id":1}`)
+	wire := server.flush()
+	feed(s, false, wire[:20])
+	feed(s, false, wire[20:])
+
+	assert.Len(t, rec.pairs, 2)
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewBufferString(rec.pairs[0].req)))
+	assert.Nil(t, err)
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, "/users", req.URL.Path)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, `{"a":1}`, string(body))
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewBufferString(rec.pairs[1].res)), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	body, _ = io.ReadAll(res.Body)
+	assert.Equal(t, `{"id":1}`, string(body))
+}
+
+func TestReassembleH2CUpgrade(t *testing.T) {
+	s, rec := newTestStream()
+	server := newH2Writer()
+
+	upgrade := "GET /a HTTP/1.1\r\nHost: x\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAARAAAAAAAIAAAAA\r\n\r\n"
+	feed(s, true, upgrade)
+
+	_ = server.framer.WriteSettings()
+	server.headers(1, false, ":status", "200")
+	server.data(1, true, "a")
+	feed(s, false, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"+server.flush())
+	feed(s, true, http2.ClientPreface)
+
+	assert.Len(t, rec.pairs, 1)
+	assert.Equal(t, upgrade, rec.pairs[0].req)
+}
+
+func TestReassembleH2SkippedHeadersKeepDecoder(t *testing.T) {
+	s, rec := newTestStream()
+	client := newH2Writer()
+	server := newH2Writer()
+
+	_ = client.framer.WriteSettings()
+	client.headers(1, true, ":method", "GET", ":path", "/a", ":authority", "x")
+	feed(s, true, http2.ClientPreface+client.flush())
+
+	// the pushed headers go into the server's dynamic table and the response refers back
+	// to them, skipping either block would leave the decoder behind
+	server.hbuf.Reset()
+	_ = server.enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/pushed"})
+	_ = server.enc.WriteField(hpack.HeaderField{Name: "x-trace", Value: "abc"})
+	_ = server.framer.WritePushPromise(http2.PushPromiseParam{
+		StreamID:      1,
+		PromiseID:     2,
+		BlockFragment: server.hbuf.Bytes(),
+		EndHeaders:    true,
+	})
+	server.headers(2, true, ":status", "200", "x-pushed", "yes")
+	server.headers(1, true, ":status", "200", "x-trace", "abc", "x-pushed", "yes")
+	feed(s, false, server.flush())
+
+	assert.Len(t, rec.pairs, 1)
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewBufferString(rec.pairs[0].res)), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "abc", res.Header.Get("X-Trace"))
+	assert.Equal(t, "yes", res.Header.Get("X-Pushed"))
+}
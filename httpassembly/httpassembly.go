@@ -1,11 +1,8 @@
 package httpassembly
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"errors"
-	"io"
 	"log/slog"
 	"net/http"
 	"sync"
@@ -49,7 +46,10 @@ func (a *HttpAssembler) ReassembleJob(ctx context.Context, wg *sync.WaitGroup) {
 		select {
 		case <-ctx.Done():
 			return
-		case msg := <-a.factory.messageQueue:
+		case msg, ok := <-a.factory.messageQueue:
+			if !ok {
+				return
+			}
 			msg.reassemble()
 		}
 	}
@@ -73,10 +73,23 @@ func (a *HttpAssembler) Assemble(p gopacket.Packet) {
 	a.assembler.AssembleWithContext(p.NetworkLayer().NetworkFlow(), tcp.(*layers.TCP), &c)
 }
 
+// UseKeyLog turns on decryption of TLS streams with secrets from the key log. Only
+// streams that start after this is called are affected.
+func (a *HttpAssembler) UseKeyLog(k *KeyLog) {
+	a.factory.keyLog = k
+}
+
 func (a *HttpAssembler) FlushCloseOlderThan(t time.Time) {
 	a.assembler.FlushCloseOlderThan(t)
 }
 
+// Close flushes every open stream and stops the reassemble job once the remaining
+// messages are handled. Assemble must not be called after Close.
+func (a *HttpAssembler) Close() {
+	a.assembler.FlushAll()
+	close(a.factory.messageQueue)
+}
+
 type HttpStreamFactory interface {
 	New() HttpStream
 }
@@ -89,6 +102,7 @@ type factoryWrapper struct {
 	wrap         HttpStreamFactory
 	counter      int
 	messageQueue chan message
+	keyLog       *KeyLog
 	Log          *slog.Logger
 }
 
@@ -108,6 +122,7 @@ func (f *factoryWrapper) New(netFlow, tcpFlow gopacket.Flow, tcp *layers.TCP, ac
 			false: newSide(),
 		},
 		messageQueue: f.messageQueue,
+		keyLog:       f.keyLog,
 	}
 	f.counter += 1
 	return &s
@@ -131,24 +146,58 @@ type streamWrapper struct {
 	opt          reassembly.TCPOptionCheck
 	messageQueue chan message
 	sides        map[reassembly.TCPFlowDirection]*side
+	h2           *h2conn // nil until the connection turns out to be HTTP/2
+	keyLog       *KeyLog
+	tls          *tlsConn // nil unless the connection is TLS and we have a key log
+	started      bool
 }
 
 type side struct {
-	buffer             []byte
-	bufferStarts       int64
-	bufferEnds         int64
-	requestQueue       [][]byte
-	requestStartsQueue []int64
+	buffer              []byte
+	bufferStarts        int64
+	bufferEnds          int64
+	framer              framer
+	requestQueue        [][]byte
+	requestStartsQueue  []int64
+	requestMethodsQueue []string
 }
 
 func newSide() *side {
 	return &side{
-		buffer:             nil,
-		requestQueue:       make([][]byte, 0, 8),
-		requestStartsQueue: make([]int64, 0, 8),
+		buffer:              nil,
+		requestQueue:        make([][]byte, 0, 8),
+		requestStartsQueue:  make([]int64, 0, 8),
+		requestMethodsQueue: make([]string, 0, 8),
 	}
 }
 
+// consume drops the first n bytes of the buffer. Whatever is left over arrived in the
+// segment seen at when.
+func (s *side) consume(n int, when int64) {
+	s.buffer = s.buffer[n:]
+	if len(s.buffer) == 0 {
+		s.reset()
+		return
+	}
+	s.bufferStarts = when
+	s.bufferEnds = when
+}
+
+// pendingMethod is the method of the oldest request still waiting on a response.
+func (s *side) pendingMethod() string {
+	if len(s.requestMethodsQueue) == 0 {
+		return ""
+	}
+	return s.requestMethodsQueue[0]
+}
+
+func (s *side) reset() {
+	s.framer.reset()
+	s.buffer = nil
+	s.bufferStarts = 0
+	s.bufferEnds = 0
+}
+
 func (s *streamWrapper) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence, start *bool, ac reassembly.AssemblerContext) bool {
 	s.Log.Debug("stream accept", "tcp", tcp.TransportFlow(), "dir", dir)
 	return true
@@ -161,7 +210,9 @@ func (s *streamWrapper) ReassembledSG(sg reassembly.ScatterGather, ac reassembly
 		return
 	}
 
-	dir, start, stop, skip := sg.Info()
+	// the segment carrying a FIN often carries data too, the stream is only closed
+	// once ReassemblyComplete says so
+	dir, start, _, skip := sg.Info()
 	if skip > 0 {
 		s.Log.Warn("dropped bytes", "skip", skip)
 	}
@@ -171,7 +222,6 @@ func (s *streamWrapper) ReassembledSG(sg reassembly.ScatterGather, ac reassembly
 		s:       s,
 		dir:     dir,
 		start:   start,
-		stop:    stop,
 		skip:    skip,
 		payload: payload,
 		when:    ac.GetCaptureInfo().Timestamp.UnixMilli(),
@@ -184,88 +234,142 @@ func (s *streamWrapper) ReassembledSG(sg reassembly.ScatterGather, ac reassembly
 
 func (s *streamWrapper) ReassemblyComplete(ac reassembly.AssemblerContext) bool {
 	s.Log.Debug("stream reassembly complete")
-	//close(s.messageQueue)
-	return false
+	// let the reassemble job know, responses delimited by the connection closing are
+	// only complete now
+	s.messageQueue <- message{s: s, stop: true}
+	return true
 }
 
 func (msg *message) reassemble() {
 	s := msg.s
+	if msg.stop {
+		s.reassembleClose()
+		return
+	}
+
 	lhs := s.sides[msg.dir]
 	rhs := s.sides[!msg.dir]
 
+	if !s.started {
+		s.started = true
+		if s.keyLog != nil && isClientHello(msg.payload) {
+			s.Log.Debug("decrypting tls")
+			s.tls = newTLSConn(s.keyLog, msg.dir, s.Log)
+		}
+	}
+
+	payload := msg.payload
+	if s.tls != nil {
+		payload = s.tls.decrypt(msg.dir, payload)
+		if len(payload) == 0 {
+			return
+		}
+	}
+
 	if len(lhs.buffer) > 0 {
-		lhs.buffer = append(lhs.buffer, msg.payload...)
+		lhs.buffer = append(lhs.buffer, payload...)
 		lhs.bufferEnds = msg.when
 	} else {
 		// no idea what the cap will be on this
-		lhs.buffer = msg.payload
+		lhs.buffer = payload
 		lhs.bufferStarts = msg.when
 		lhs.bufferEnds = msg.when
 	}
 
-	// try request
-	req, reqErr := http.ReadRequest(bufio.NewReader(bytes.NewReader(lhs.buffer)))
-	if reqErr == nil {
-		// affirmative on the request path
-		_, bodyErr := io.ReadAll(req.Body)
-		defer req.Body.Close()
+	// A single segment can hold several pipelined messages, or the tail of one message
+	// and the head of the next, so keep going until we run out of complete messages.
+	for len(lhs.buffer) > 0 {
+		if s.h2 == nil {
+			isPreface, err := isClientPreface(lhs.buffer)
+			if err != nil {
+				return
+			}
+			if isPreface {
+				s.Log.Debug("switching to http2")
+				s.h2 = newH2Conn(msg.dir)
+			}
+		}
 
-		if errors.Is(bodyErr, io.ErrUnexpectedEOF) {
+		if s.h2 != nil {
+			s.reassembleH2(lhs, msg.dir, msg.when)
+			return
+		}
+
+		f, err := lhs.framer.next(lhs.buffer, rhs.pendingMethod())
+		if errors.Is(err, errIncomplete) {
 			// still need more out of the stream
-			s.Log.Debug("waiting for more request data", "have", len(lhs.buffer))
+			s.Log.Debug("waiting for more data", "have", len(lhs.buffer))
+			return
+		}
+		if err != nil {
+			s.Log.Warn("dropped unparseable data", "err", err, "len", len(lhs.buffer))
+			lhs.reset()
 			return
 		}
 
-		lhs.requestQueue = append(lhs.requestQueue, lhs.buffer)
-		lhs.requestStartsQueue = append(lhs.requestStartsQueue, lhs.bufferStarts)
-		lhs.buffer = make([]byte, 0, 512)
-		lhs.bufferStarts = 0
-		lhs.bufferEnds = 0
-		return
+		s.reassembled(lhs, rhs, msg.dir, f, msg.when)
 	}
+}
 
-	var rhsReq *http.Request
-	if len(rhs.requestQueue) > 0 {
-		r, rhsReqErr := http.ReadRequest(bufio.NewReader(bytes.NewReader(rhs.requestQueue[0])))
-		if rhsReqErr != nil {
-			panic("shouldn't fail because we already checked its a request")
+// reassembleClose flushes whatever the end of the stream completes.
+func (s *streamWrapper) reassembleClose() {
+	for dir, lhs := range s.sides {
+		if f, ok := lhs.framer.close(lhs.buffer); ok {
+			s.reassembled(lhs, s.sides[!dir], dir, f, lhs.bufferEnds)
 		}
-		rhsReq = r
+		lhs.reset()
 	}
+}
 
-	// try response
-	res, resErr := http.ReadResponse(bufio.NewReader(bytes.NewReader(lhs.buffer)), rhsReq)
-	if resErr == nil {
-		// affirmative on response path
-		_, bodyErr := io.ReadAll(res.Body)
-		defer res.Body.Close()
+// reassembled handles the complete message f at the start of lhs.buffer, which is the
+// side of the stream going in direction dir.
+func (s *streamWrapper) reassembled(lhs, rhs *side, dir reassembly.TCPFlowDirection, f framed, when int64) {
+	payload := lhs.buffer[:f.length:f.length]
+	ends := lhs.bufferEnds
 
-		if errors.Is(bodyErr, io.ErrUnexpectedEOF) {
-			// still need more out of the stream
-			s.Log.Debug("waiting for more response data", "have", len(lhs.buffer))
-			return
-		}
+	if !f.response {
+		lhs.requestQueue = append(lhs.requestQueue, payload)
+		lhs.requestStartsQueue = append(lhs.requestStartsQueue, lhs.bufferStarts)
+		lhs.requestMethodsQueue = append(lhs.requestMethodsQueue, f.method)
+		lhs.consume(f.length, when)
+		return
+	}
 
-		if rhsReq != nil {
-			s.Log.Debug("handled rr")
-
-			// should be in seconds
-			duration := float64(lhs.bufferEnds-rhs.requestStartsQueue[0]) / 1000.0
-			s.Log.Debug("duration", "v", duration, "a", lhs.bufferEnds, "b", rhs.requestStartsQueue[0])
-
-			s.wrap.ReassembledRequestResponse(rhs.requestQueue[0], lhs.buffer, duration)
-			lhs.buffer = nil
-			lhs.bufferStarts = 0
-			lhs.bufferEnds = 0
-			rhs.requestQueue = rhs.requestQueue[1:]
-			rhs.requestStartsQueue = rhs.requestStartsQueue[1:]
-		} else {
-			s.Log.Debug("dropped rr")
-			lhs.buffer = nil
-			lhs.bufferStarts = 0
-			lhs.bufferEnds = 0
-		}
+	lhs.consume(f.length, when)
+
+	if f.status >= 100 && f.status < 200 && f.status != http.StatusSwitchingProtocols {
+		// interim response, the final one for this request is still to come
+		s.Log.Debug("skipped informational response", "status", f.status)
+		return
+	}
+
+	if len(rhs.requestQueue) == 0 {
+		s.Log.Debug("dropped rr")
+		return
+	}
 
+	if f.status == http.StatusSwitchingProtocols && isH2CUpgrade(rhs.requestQueue[0]) {
+		// the response to the upgrade request comes back as stream 1
+		s.Log.Debug("switching to http2 by upgrade")
+		s.h2 = newH2Conn(!dir)
+		s.h2.streams[1] = &h2stream{
+			reqStarts: rhs.requestStartsQueue[0],
+			upgrade:   rhs.requestQueue[0],
+		}
+		rhs.requestQueue = rhs.requestQueue[1:]
+		rhs.requestStartsQueue = rhs.requestStartsQueue[1:]
+		rhs.requestMethodsQueue = rhs.requestMethodsQueue[1:]
 		return
 	}
+
+	s.Log.Debug("handled rr")
+
+	// should be in seconds
+	duration := float64(ends-rhs.requestStartsQueue[0]) / 1000.0
+	s.Log.Debug("duration", "v", duration, "a", ends, "b", rhs.requestStartsQueue[0])
+
+	s.wrap.ReassembledRequestResponse(rhs.requestQueue[0], payload, duration)
+	rhs.requestQueue = rhs.requestQueue[1:]
+	rhs.requestStartsQueue = rhs.requestStartsQueue[1:]
+	rhs.requestMethodsQueue = rhs.requestMethodsQueue[1:]
 }
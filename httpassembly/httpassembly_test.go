@@ -0,0 +1,153 @@
+package httpassembly
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/reassembly"
+	"github.com/stretchr/testify/assert"
+)
+
+type pair struct {
+	req string
+	res string
+}
+
+type recordingStream struct {
+	pairs []pair
+}
+
+func (r *recordingStream) ReassembledRequestResponse(req []byte, res []byte, duration float64) {
+	r.pairs = append(r.pairs, pair{req: string(req), res: string(res)})
+}
+
+func newTestStream() (*streamWrapper, *recordingStream) {
+	rec := &recordingStream{}
+	s := &streamWrapper{
+		Log:  slog.Default(),
+		wrap: rec,
+		sides: map[reassembly.TCPFlowDirection]*side{
+			true:  newSide(),
+			false: newSide(),
+		},
+	}
+	return s, rec
+}
+
+func feed(s *streamWrapper, dir reassembly.TCPFlowDirection, payload string) {
+	msg := message{s: s, dir: dir, payload: []byte(payload)}
+	msg.reassemble()
+}
+
+const (
+	reqA = "GET /a HTTP/1.1\r\nHost: x\r\n\r\n"
+	reqB = "POST /b HTTP/1.1\r\nHost: x\r\nContent-Length: 2\r\n\r\n{}"
+	resA = "HTTP/1.1 200 OK\r\nContent-Length: 1\r\n\r\na"
+	resB = "HTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\n{}"
+)
+
+func TestReassemblePipelinedRequests(t *testing.T) {
+	s, rec := newTestStream()
+	feed(s, true, reqA+reqB)
+	feed(s, false, resA+resB)
+
+	assert.Equal(t, []pair{{reqA, resA}, {reqB, resB}}, rec.pairs)
+}
+
+func TestReassembleMessagesSplitAcrossSegments(t *testing.T) {
+	s, rec := newTestStream()
+	feed(s, true, reqA+reqB[:10])
+	feed(s, true, reqB[10:])
+	feed(s, false, resA[:20])
+	feed(s, false, resA[20:]+resB[:5])
+	assert.Equal(t, []pair{{reqA, resA}}, rec.pairs)
+
+	feed(s, false, resB[5:])
+	assert.Equal(t, []pair{{reqA, resA}, {reqB, resB}}, rec.pairs)
+}
+
+func TestReassembleSkipsInformationalResponses(t *testing.T) {
+	s, rec := newTestStream()
+	cont := "HTTP/1.1 100 Continue\r\n\r\n"
+	feed(s, true, reqB)
+	feed(s, false, cont+resB)
+
+	assert.Equal(t, []pair{{reqB, resB}}, rec.pairs)
+}
+
+func TestReassembleDropsGarbage(t *testing.T) {
+	s, rec := newTestStream()
+	feed(s, true, "\x00\x01 not http at all\r\n\r\n")
+	feed(s, true, reqA)
+	feed(s, false, resA)
+
+	assert.Equal(t, []pair{{reqA, resA}}, rec.pairs)
+	assert.Empty(t, s.sides[true].buffer)
+}
+
+func TestReassembleChunkedResponse(t *testing.T) {
+	s, rec := newTestStream()
+	res := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5\r\nhello\r\n6;ext=1\r\n world\r\n0\r\nX-Trailer: y\r\n\r\n"
+	feed(s, true, reqA)
+	for i := 0; i < len(res); i += 7 {
+		feed(s, false, res[i:min(i+7, len(res))])
+	}
+
+	assert.Equal(t, []pair{{reqA, res}}, rec.pairs)
+}
+
+func TestReassembleCloseDelimitedResponse(t *testing.T) {
+	s, rec := newTestStream()
+	res := "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nall of this is the body"
+	feed(s, true, reqA)
+	feed(s, false, res)
+	assert.Empty(t, rec.pairs)
+
+	msg := message{s: s, stop: true}
+	msg.reassemble()
+	assert.Equal(t, []pair{{reqA, res}}, rec.pairs)
+}
+
+func TestReassembleHeadResponseHasNoBody(t *testing.T) {
+	s, rec := newTestStream()
+	head := "HEAD /a HTTP/1.1\r\nHost: x\r\n\r\n"
+	headRes := "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n"
+	feed(s, true, head+reqA)
+	feed(s, false, headRes+resA)
+
+	assert.Equal(t, []pair{{head, headRes}, {reqA, resA}}, rec.pairs)
+}
+
+// finSG is a single reassembled segment, with the FIN flag set.
+type finSG struct {
+	dir     reassembly.TCPFlowDirection
+	payload []byte
+}
+
+func (sg *finSG) Lengths() (int, int)                         { return len(sg.payload), 0 }
+func (sg *finSG) Fetch(length int) []byte                     { return sg.payload[:length] }
+func (sg *finSG) KeepFrom(offset int)                         {}
+func (sg *finSG) CaptureInfo(offset int) gopacket.CaptureInfo { return gopacket.CaptureInfo{} }
+func (sg *finSG) Stats() reassembly.TCPAssemblyStats          { return reassembly.TCPAssemblyStats{} }
+func (sg *finSG) Info() (reassembly.TCPFlowDirection, bool, bool, int) {
+	return sg.dir, false, true, 0
+}
+
+func TestReassembleDataWithFin(t *testing.T) {
+	s, rec := newTestStream()
+	s.messageQueue = make(chan message, 4)
+	res := "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nall of this is the body"
+	ac := &assemblyContext{}
+
+	s.ReassembledSG(&finSG{dir: true, payload: []byte(reqA)}, ac)
+	s.ReassembledSG(&finSG{dir: false, payload: []byte(res)}, ac)
+	s.ReassemblyComplete(ac)
+	close(s.messageQueue)
+	for msg := range s.messageQueue {
+		msg.reassemble()
+	}
+
+	assert.Equal(t, []pair{{reqA, res}}, rec.pairs)
+}
@@ -0,0 +1,128 @@
+package httpassembly
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NSS key log labels, see
+// https://developer.mozilla.org/en-US/docs/Mozilla/Projects/NSS/Key_Log_Format
+const (
+	keyLogClientRandom         = "CLIENT_RANDOM"
+	keyLogClientTrafficSecret0 = "CLIENT_TRAFFIC_SECRET_0"
+	keyLogServerTrafficSecret0 = "SERVER_TRAFFIC_SECRET_0"
+)
+
+// KeyLog holds the secrets from an NSS key log file, the kind written by applications
+// when SSLKEYLOGFILE is set. Applications keep appending to the file as they make new
+// connections, so anything we can't find triggers a read of whatever was added since,
+// if the file changed at all.
+type KeyLog struct {
+	fileName string
+
+	mu      sync.Mutex
+	offset  int64
+	size    int64
+	modTime time.Time
+	secrets map[string][]byte
+}
+
+func NewKeyLog(fileName string) (*KeyLog, error) {
+	k := &KeyLog{
+		fileName: fileName,
+		secrets:  make(map[string][]byte),
+	}
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// secret returns the secret logged for label and the connection's client random.
+func (k *KeyLog) secret(label string, clientRandom []byte) ([]byte, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key := keyLogKey(label, clientRandom)
+	if s, in := k.secrets[key]; in {
+		return s, true
+	}
+
+	if err := k.load(); err != nil {
+		return nil, false
+	}
+
+	s, in := k.secrets[key]
+	return s, in
+}
+
+// load reads anything added to the file since the last time. A file that hasn't
+// changed isn't read again, secrets for connections that aren't in it are looked up on
+// every packet.
+func (k *KeyLog) load() error {
+	st, err := os.Stat(k.fileName)
+	if err != nil {
+		return err
+	}
+	if st.Size() == k.size && st.ModTime().Equal(k.modTime) {
+		return nil
+	}
+
+	f, err := os.Open(k.fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// anything written after the stat shows up as a change next time
+	k.size, k.modTime = st.Size(), st.ModTime()
+	if st.Size() < k.offset {
+		// truncated, start over
+		k.offset = 0
+	}
+
+	if _, err := f.Seek(k.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// leave a partly written line for next time
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		k.offset += int64(len(line))
+		k.parseLine(line)
+	}
+}
+
+func (k *KeyLog) parseLine(line string) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+		return
+	}
+
+	clientRandom, err := hex.DecodeString(fields[1])
+	if err != nil {
+		return
+	}
+	secret, err := hex.DecodeString(fields[2])
+	if err != nil {
+		return
+	}
+
+	k.secrets[keyLogKey(fields[0], clientRandom)] = secret
+}
+
+func keyLogKey(label string, clientRandom []byte) string {
+	return label + " " + string(clientRandom)
+}
@@ -0,0 +1,302 @@
+package httpassembly
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// errIncomplete means the buffer holds the start of a message but not all of it yet.
+var errIncomplete = errors.New("incomplete message")
+
+var (
+	errHeaderTooLarge = errors.New("message header too large")
+	errChunkLine      = errors.New("malformed chunk line")
+)
+
+var responsePrefix = []byte("HTTP/")
+
+const (
+	// maxHeaderBytes bounds how long we wait for the end of a header block before
+	// giving up on the buffer, so garbage can't grow it forever.
+	maxHeaderBytes = 1 << 20
+	// maxLineBytes does the same for chunk size and trailer lines.
+	maxLineBytes = 4096
+)
+
+type framerState int
+
+const (
+	stateHeader framerState = iota
+	stateLength
+	stateChunkSize
+	stateChunkData
+	stateChunkDataEnd
+	stateTrailer
+	stateUntilClose
+)
+
+// framer finds message boundaries in one side of a stream. The buffer it is given
+// always starts at the current message and only grows between calls, so it picks up
+// where it left off instead of parsing the whole message again every time another
+// segment arrives. Chunked, Content-Length and close-delimited bodies are supported.
+type framer struct {
+	state     framerState
+	pos       int   // bytes of the current message already accounted for
+	remaining int64 // bytes left in a Content-Length body or the current chunk
+	current   framed
+}
+
+// framed describes a complete message at the start of the buffer.
+type framed struct {
+	length   int
+	response bool
+	method   string // requests only
+	status   int    // responses only
+}
+
+// next advances over buf and returns the message at its start once all of it is
+// there. A response needs the method of the request it answers to know if it has a
+// body, method is empty if that request was never seen.
+func (f *framer) next(buf []byte, method string) (framed, error) {
+	for {
+		var err error
+		switch f.state {
+		case stateHeader:
+			err = f.header(buf, method)
+		case stateLength:
+			err = f.length(buf)
+		case stateChunkSize:
+			err = f.chunkSize(buf)
+		case stateChunkData:
+			err = f.chunkData(buf)
+		case stateChunkDataEnd:
+			err = f.chunkDataEnd(buf)
+		case stateTrailer:
+			err = f.trailer(buf)
+		case stateUntilClose:
+			// only the end of the stream tells us where this one stops
+			f.pos = len(buf)
+			err = errIncomplete
+		}
+
+		if err != nil {
+			if !errors.Is(err, errIncomplete) {
+				f.reset()
+			}
+			return framed{}, err
+		}
+
+		if f.state == stateHeader {
+			// we've made it back to the start, the message is done
+			res := f.current
+			res.length = f.pos
+			f.reset()
+			return res, nil
+		}
+	}
+}
+
+// close is called when the stream ends. A message that runs until the connection is
+// closed is complete at that point, anything else still in flight never will be.
+func (f *framer) close(buf []byte) (framed, bool) {
+	defer f.reset()
+	if f.state != stateUntilClose {
+		return framed{}, false
+	}
+	res := f.current
+	res.length = len(buf)
+	return res, true
+}
+
+func (f *framer) reset() {
+	*f = framer{}
+}
+
+func (f *framer) header(buf []byte, method string) error {
+	// a header block can't be split by the time we get here, only the end of it may
+	// be missing, so just look at the new bytes and the few before them
+	from := max(0, f.pos-3)
+	end := headerEnd(buf, from)
+	if end < 0 {
+		f.pos = len(buf)
+		if len(buf) > maxHeaderBytes {
+			return errHeaderTooLarge
+		}
+		return errIncomplete
+	}
+
+	f.pos = end
+	if bytes.HasPrefix(buf, responsePrefix) {
+		return f.responseHeader(buf[:end], method)
+	}
+	return f.requestHeader(buf[:end])
+}
+
+func (f *framer) requestHeader(hdr []byte) error {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(hdr)))
+	if err != nil {
+		return err
+	}
+
+	f.current = framed{method: req.Method}
+	f.body(isChunked(req.TransferEncoding), req.ContentLength, false)
+	return nil
+}
+
+func (f *framer) responseHeader(hdr []byte, method string) error {
+	var req *http.Request
+	if method != "" {
+		req = &http.Request{Method: method}
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(hdr)), req)
+	if err != nil {
+		return err
+	}
+
+	f.current = framed{response: true, status: res.StatusCode}
+	if !bodyAllowed(method, res.StatusCode) {
+		f.body(false, 0, false)
+		return nil
+	}
+	f.body(isChunked(res.TransferEncoding), res.ContentLength, true)
+	return nil
+}
+
+func (f *framer) body(chunked bool, contentLength int64, response bool) {
+	switch {
+	case chunked:
+		f.state = stateChunkSize
+	case contentLength > 0:
+		f.state = stateLength
+		f.remaining = contentLength
+	case contentLength < 0 && response:
+		// no length and not chunked, the body runs until the server closes
+		f.state = stateUntilClose
+	default:
+		f.state = stateHeader
+	}
+}
+
+func (f *framer) length(buf []byte) error {
+	if !f.skip(buf) {
+		return errIncomplete
+	}
+	f.state = stateHeader
+	return nil
+}
+
+func (f *framer) chunkSize(buf []byte) error {
+	line, err := f.line(buf)
+	if err != nil {
+		return err
+	}
+
+	if i := bytes.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	size, err := strconv.ParseInt(string(bytes.TrimSpace(line)), 16, 64)
+	if err != nil || size < 0 {
+		return errChunkLine
+	}
+
+	if size == 0 {
+		f.state = stateTrailer
+	} else {
+		f.state = stateChunkData
+		f.remaining = size
+	}
+	return nil
+}
+
+func (f *framer) chunkData(buf []byte) error {
+	if !f.skip(buf) {
+		return errIncomplete
+	}
+	f.state = stateChunkDataEnd
+	return nil
+}
+
+func (f *framer) chunkDataEnd(buf []byte) error {
+	line, err := f.line(buf)
+	if err != nil {
+		return err
+	}
+	if len(line) != 0 {
+		return errChunkLine
+	}
+	f.state = stateChunkSize
+	return nil
+}
+
+func (f *framer) trailer(buf []byte) error {
+	line, err := f.line(buf)
+	if err != nil {
+		return err
+	}
+	if len(line) == 0 {
+		f.state = stateHeader
+	}
+	return nil
+}
+
+// skip moves past f.remaining bytes, returning false if the buffer ends first.
+func (f *framer) skip(buf []byte) bool {
+	have := int64(len(buf) - f.pos)
+	if have < f.remaining {
+		f.pos = len(buf)
+		f.remaining -= have
+		return false
+	}
+	f.pos += int(f.remaining)
+	f.remaining = 0
+	return true
+}
+
+// line returns the next line without its terminator and moves past it.
+func (f *framer) line(buf []byte) ([]byte, error) {
+	i := bytes.IndexByte(buf[f.pos:], '\n')
+	if i < 0 {
+		if len(buf)-f.pos > maxLineBytes {
+			return nil, errChunkLine
+		}
+		return nil, errIncomplete
+	}
+	line := bytes.TrimSuffix(buf[f.pos:f.pos+i], []byte("\r"))
+	f.pos += i + 1
+	return line, nil
+}
+
+// headerEnd returns the index just past the blank line ending the header block in
+// buf, or -1 if there isn't one yet.
+func headerEnd(buf []byte, from int) int {
+	for i := from; i < len(buf); i++ {
+		if buf[i] != '\n' {
+			continue
+		}
+		if i+1 < len(buf) && buf[i+1] == '\n' {
+			return i + 2
+		}
+		if i+2 < len(buf) && buf[i+1] == '\r' && buf[i+2] == '\n' {
+			return i + 3
+		}
+	}
+	return -1
+}
+
+func isChunked(te []string) bool {
+	return len(te) > 0 && te[len(te)-1] == "chunked"
+}
+
+func bodyAllowed(method string, status int) bool {
+	if method == http.MethodHead {
+		return false
+	}
+	if status >= 100 && status < 200 {
+		return false
+	}
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,48 @@
+package httpassembly
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFramerByteAtATime(t *testing.T) {
+	msg := "POST /b HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n"
+	f := framer{}
+	for i := 1; i < len(msg); i++ {
+		_, err := f.next([]byte(msg[:i]), "")
+		assert.ErrorIs(t, err, errIncomplete, "prefix %d", i)
+	}
+
+	res, err := f.next([]byte(msg+"GET"), "")
+	assert.Nil(t, err)
+	assert.Equal(t, framed{length: len(msg), method: "POST"}, res)
+}
+
+func TestFramerContentLength(t *testing.T) {
+	f := framer{}
+	res, err := f.next([]byte(resB+"HTTP/1.1"), "POST")
+	assert.Nil(t, err)
+	assert.Equal(t, framed{length: len(resB), response: true, status: 201}, res)
+}
+
+func TestFramerNoContent(t *testing.T) {
+	f := framer{}
+	msg := "HTTP/1.1 204 No Content\r\n\r\n"
+	res, err := f.next([]byte(msg), "DELETE")
+	assert.Nil(t, err)
+	assert.Equal(t, len(msg), res.length)
+}
+
+func TestFramerMalformedChunk(t *testing.T) {
+	f := framer{}
+	_, err := f.next([]byte("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n"), "GET")
+	assert.ErrorIs(t, err, errChunkLine)
+	assert.Equal(t, framer{}, f)
+}
+
+func TestFramerHeaderTooLarge(t *testing.T) {
+	f := framer{}
+	_, err := f.next(make([]byte, maxHeaderBytes+1), "")
+	assert.ErrorIs(t, err, errHeaderTooLarge)
+}
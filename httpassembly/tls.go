@@ -0,0 +1,502 @@
+package httpassembly
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"log/slog"
+
+	"github.com/google/gopacket/reassembly"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	recordTypeChangeCipherSpec = 20
+	recordTypeAlert            = 21
+	recordTypeHandshake        = 22
+	recordTypeApplicationData  = 23
+
+	handshakeTypeClientHello = 1
+	handshakeTypeServerHello = 2
+
+	extensionSupportedVersions = 43
+
+	recordHeaderLen = 5
+	// maxRecordLen is the largest record allowed, ciphertext expansion included.
+	maxRecordLen = 1<<14 + 2048
+)
+
+var (
+	errUnsupportedCipherSuite = errors.New("unsupported cipher suite")
+	errMissingSecret          = errors.New("secret not in key log")
+)
+
+// helloRetryRandom marks a ServerHello that is really a HelloRetryRequest.
+var helloRetryRandom = []byte{
+	0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11, 0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+	0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E, 0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+}
+
+// isClientHello reports whether buf starts with a TLS handshake record carrying a
+// ClientHello.
+func isClientHello(buf []byte) bool {
+	return len(buf) > recordHeaderLen &&
+		buf[0] == recordTypeHandshake &&
+		buf[1] == 3 && buf[2] <= 4 &&
+		buf[recordHeaderLen] == handshakeTypeClientHello
+}
+
+// tlsConn follows the handshake of a TLS connection and decrypts its application data
+// with secrets from a key log. Only the AEAD cipher suites are supported, which is
+// everything TLS 1.3 has and what any modern TLS 1.2 server picks.
+type tlsConn struct {
+	keyLog       *KeyLog
+	client       reassembly.TCPFlowDirection
+	clientRandom []byte
+	serverRandom []byte
+	version      uint16
+	suite        uint16
+	sides        map[reassembly.TCPFlowDirection]*tlsSide
+	Log          *slog.Logger
+}
+
+type tlsSide struct {
+	buffer    []byte
+	encrypted bool // everything from here on is protected
+	appKeys   bool // TLS 1.3 only, application traffic keys are in use
+	keys      *recordKeys
+	seq       uint64
+	skipped   uint64 // TLS 1.3 only, records that went by before the keys were logged
+	failed    bool
+}
+
+func newTLSConn(keyLog *KeyLog, client reassembly.TCPFlowDirection, log *slog.Logger) *tlsConn {
+	return &tlsConn{
+		keyLog: keyLog,
+		client: client,
+		sides: map[reassembly.TCPFlowDirection]*tlsSide{
+			true:  {},
+			false: {},
+		},
+		Log: log,
+	}
+}
+
+// decrypt takes the next bytes sent in direction dir and returns whatever application
+// data they complete.
+func (c *tlsConn) decrypt(dir reassembly.TCPFlowDirection, payload []byte) []byte {
+	ts := c.sides[dir]
+	ts.buffer = append(ts.buffer, payload...)
+
+	var plaintext []byte
+	for len(ts.buffer) >= recordHeaderLen {
+		n := recordHeaderLen + int(binary.BigEndian.Uint16(ts.buffer[3:5]))
+		if n > recordHeaderLen+maxRecordLen {
+			c.Log.Warn("dropped oversized tls record", "len", n)
+			ts.buffer = nil
+			break
+		}
+		if len(ts.buffer) < n {
+			break
+		}
+
+		record := ts.buffer[:n:n]
+		ts.buffer = ts.buffer[n:]
+		plaintext = append(plaintext, c.record(dir, ts, record)...)
+	}
+
+	if len(ts.buffer) == 0 {
+		ts.buffer = nil
+	}
+	return plaintext
+}
+
+func (c *tlsConn) record(dir reassembly.TCPFlowDirection, ts *tlsSide, record []byte) []byte {
+	typ := record[0]
+	body := record[recordHeaderLen:]
+
+	if c.version == tls.VersionTLS13 {
+		switch typ {
+		case recordTypeHandshake:
+			c.handshake(body)
+		case recordTypeApplicationData:
+			return c.record13(dir, ts, record)
+		}
+		// change cipher spec is only there to keep middleboxes happy in 1.3
+		return nil
+	}
+
+	if typ == recordTypeChangeCipherSpec {
+		ts.encrypted = true
+		ts.seq = 0
+		return nil
+	}
+
+	if !ts.encrypted {
+		if typ == recordTypeHandshake {
+			c.handshake(body)
+		}
+		return nil
+	}
+
+	return c.record12(dir, ts, record)
+}
+
+// record12 decrypts a protected TLS 1.2 record. Every record counts toward the sequence
+// number, but only application data is handed on.
+func (c *tlsConn) record12(dir reassembly.TCPFlowDirection, ts *tlsSide, record []byte) []byte {
+	seq := ts.seq
+	ts.seq++
+
+	if !c.setupKeys12(dir, ts) {
+		return nil
+	}
+
+	plaintext, err := ts.keys.open12(seq, record)
+	if err != nil {
+		c.Log.Warn("could not decrypt tls record", "err", err)
+		return nil
+	}
+
+	if record[0] != recordTypeApplicationData {
+		return nil
+	}
+	return plaintext
+}
+
+// record13 decrypts a protected TLS 1.3 record. The rest of the handshake is protected
+// with keys we don't bother with, so until a record opens with the application traffic
+// keys it is assumed to be part of the handshake.
+func (c *tlsConn) record13(dir reassembly.TCPFlowDirection, ts *tlsSide, record []byte) []byte {
+	if !c.setupKeys13(dir, ts) {
+		ts.skipped++
+		return nil
+	}
+
+	var plaintext []byte
+	if ts.appKeys {
+		var err error
+		plaintext, err = ts.keys.open13(ts.seq, record)
+		ts.seq++
+		if err != nil {
+			c.Log.Warn("could not decrypt tls record", "err", err)
+			return nil
+		}
+	} else {
+		// Records skipped while waiting on the key log could have been the end of the
+		// handshake or application data, only the data counts toward the sequence
+		// number. Whichever number opens the record is the one.
+		for seq := uint64(0); seq <= ts.skipped && !ts.appKeys; seq++ {
+			if p, err := ts.keys.open13(seq, record); err == nil {
+				plaintext = p
+				ts.appKeys = true
+				ts.seq = seq + 1
+			}
+		}
+		if !ts.appKeys {
+			return nil
+		}
+	}
+
+	// the real content type is the last non-zero byte
+	plaintext = bytes.TrimRight(plaintext, "\x00")
+	if len(plaintext) == 0 {
+		return nil
+	}
+	typ := plaintext[len(plaintext)-1]
+	if typ != recordTypeApplicationData {
+		return nil
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func (c *tlsConn) setupKeys12(dir reassembly.TCPFlowDirection, ts *tlsSide) bool {
+	if ts.keys != nil || ts.failed {
+		return ts.keys != nil
+	}
+
+	masterSecret, in := c.keyLog.secret(keyLogClientRandom, c.clientRandom)
+	if !in {
+		c.Log.Debug("waiting on key log", "err", errMissingSecret)
+		return false
+	}
+
+	keys, err := newRecordKeys12(c.suite, masterSecret, c.clientRandom, c.serverRandom, dir == c.client)
+	if err != nil {
+		c.Log.Warn("cannot decrypt tls", "err", err, "suite", tls.CipherSuiteName(c.suite))
+		ts.failed = true
+		return false
+	}
+	ts.keys = keys
+	return true
+}
+
+func (c *tlsConn) setupKeys13(dir reassembly.TCPFlowDirection, ts *tlsSide) bool {
+	if ts.keys != nil || ts.failed {
+		return ts.keys != nil
+	}
+
+	label := keyLogServerTrafficSecret0
+	if dir == c.client {
+		label = keyLogClientTrafficSecret0
+	}
+
+	secret, in := c.keyLog.secret(label, c.clientRandom)
+	if !in {
+		c.Log.Debug("waiting on key log", "err", errMissingSecret, "label", label)
+		return false
+	}
+
+	keys, err := newRecordKeys13(c.suite, secret)
+	if err != nil {
+		c.Log.Warn("cannot decrypt tls", "err", err, "suite", tls.CipherSuiteName(c.suite))
+		ts.failed = true
+		return false
+	}
+	ts.keys = keys
+	return true
+}
+
+// handshake picks the randoms, version and cipher suite out of the plaintext hellos.
+func (c *tlsConn) handshake(body []byte) {
+	for len(body) >= 4 {
+		typ := body[0]
+		n := 4 + (int(body[1])<<16 | int(body[2])<<8 | int(body[3]))
+		if len(body) < n {
+			// fragmented hello, not worth the trouble
+			return
+		}
+		msg := body[4:n]
+		body = body[n:]
+
+		switch typ {
+		case handshakeTypeClientHello:
+			if len(msg) >= 34 {
+				c.clientRandom = bytes.Clone(msg[2:34])
+			}
+		case handshakeTypeServerHello:
+			c.serverHello(msg)
+		}
+	}
+}
+
+func (c *tlsConn) serverHello(msg []byte) {
+	if len(msg) < 35 {
+		return
+	}
+	version := binary.BigEndian.Uint16(msg[0:2])
+	random := msg[2:34]
+	if bytes.Equal(random, helloRetryRandom) {
+		// the real ServerHello comes after the client tries again
+		return
+	}
+
+	rest := msg[34:]
+	sidLen := int(rest[0])
+	if len(rest) < 1+sidLen+3 {
+		return
+	}
+	rest = rest[1+sidLen:]
+	c.suite = binary.BigEndian.Uint16(rest[0:2])
+	c.serverRandom = bytes.Clone(random)
+	c.version = version
+
+	// TLS 1.3 pretends to be 1.2 and puts the real version in an extension
+	rest = rest[3:]
+	if len(rest) < 2 {
+		return
+	}
+	exts := rest[2:]
+	for len(exts) >= 4 {
+		typ := binary.BigEndian.Uint16(exts[0:2])
+		n := 4 + int(binary.BigEndian.Uint16(exts[2:4]))
+		if len(exts) < n {
+			return
+		}
+		if typ == extensionSupportedVersions && n == 6 {
+			c.version = binary.BigEndian.Uint16(exts[4:6])
+		}
+		exts = exts[n:]
+	}
+}
+
+// recordKeys protects one direction of a connection.
+type recordKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	// explicitNonce is set for the TLS 1.2 GCM suites, which send part of the nonce
+	// in front of each record
+	explicitNonce bool
+}
+
+type suiteParams struct {
+	keyLen        int
+	ivLen         int // the implicit part for TLS 1.2
+	hash          func() hash.Hash
+	chacha        bool
+	explicitNonce bool
+}
+
+func suiteParamsFor(suite uint16) (suiteParams, error) {
+	switch suite {
+	case tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_RSA_WITH_AES_128_GCM_SHA256:
+		return suiteParams{keyLen: 16, ivLen: 4, hash: sha256.New, explicitNonce: true}, nil
+	case tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_RSA_WITH_AES_256_GCM_SHA384:
+		return suiteParams{keyLen: 32, ivLen: 4, hash: sha512.New384, explicitNonce: true}, nil
+	case tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256:
+		return suiteParams{keyLen: 32, ivLen: 12, hash: sha256.New, chacha: true}, nil
+	case tls.TLS_AES_128_GCM_SHA256:
+		return suiteParams{keyLen: 16, ivLen: 12, hash: sha256.New}, nil
+	case tls.TLS_AES_256_GCM_SHA384:
+		return suiteParams{keyLen: 32, ivLen: 12, hash: sha512.New384}, nil
+	case tls.TLS_CHACHA20_POLY1305_SHA256:
+		return suiteParams{keyLen: 32, ivLen: 12, hash: sha256.New, chacha: true}, nil
+	}
+	return suiteParams{}, errUnsupportedCipherSuite
+}
+
+func newAEAD(p suiteParams, key []byte) (cipher.AEAD, error) {
+	if p.chacha {
+		return chacha20poly1305.New(key)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newRecordKeys12 derives the keys for one direction from a TLS 1.2 master secret.
+func newRecordKeys12(suite uint16, masterSecret, clientRandom, serverRandom []byte, client bool) (*recordKeys, error) {
+	p, err := suiteParamsFor(suite)
+	if err != nil {
+		return nil, err
+	}
+
+	// AEAD suites have no MAC keys, so the key block is just keys then IVs
+	seed := append(bytes.Clone(serverRandom), clientRandom...)
+	block := prf12(p.hash, masterSecret, []byte("key expansion"), seed, 2*p.keyLen+2*p.ivLen)
+	clientKey, block := block[:p.keyLen], block[p.keyLen:]
+	serverKey, block := block[:p.keyLen], block[p.keyLen:]
+	clientIV, serverIV := block[:p.ivLen], block[p.ivLen:]
+
+	key, iv := serverKey, serverIV
+	if client {
+		key, iv = clientKey, clientIV
+	}
+
+	aead, err := newAEAD(p, key)
+	if err != nil {
+		return nil, err
+	}
+	return &recordKeys{aead: aead, iv: iv, explicitNonce: p.explicitNonce}, nil
+}
+
+// newRecordKeys13 derives the keys for one direction from a TLS 1.3 traffic secret.
+func newRecordKeys13(suite uint16, secret []byte) (*recordKeys, error) {
+	p, err := suiteParamsFor(suite)
+	if err != nil {
+		return nil, err
+	}
+
+	key := hkdfExpandLabel(p.hash, secret, "key", p.keyLen)
+	iv := hkdfExpandLabel(p.hash, secret, "iv", p.ivLen)
+
+	aead, err := newAEAD(p, key)
+	if err != nil {
+		return nil, err
+	}
+	return &recordKeys{aead: aead, iv: iv}, nil
+}
+
+func (k *recordKeys) open12(seq uint64, record []byte) ([]byte, error) {
+	ciphertext := record[recordHeaderLen:]
+
+	var nonce []byte
+	if k.explicitNonce {
+		if len(ciphertext) < 8 {
+			return nil, errors.New("record too short")
+		}
+		nonce = append(bytes.Clone(k.iv), ciphertext[:8]...)
+		ciphertext = ciphertext[8:]
+	} else {
+		nonce = k.sequenceNonce(seq)
+	}
+
+	if len(ciphertext) < k.aead.Overhead() {
+		return nil, errors.New("record too short")
+	}
+
+	ad := make([]byte, 13)
+	binary.BigEndian.PutUint64(ad, seq)
+	copy(ad[8:11], record[:3])
+	binary.BigEndian.PutUint16(ad[11:], uint16(len(ciphertext)-k.aead.Overhead()))
+
+	return k.aead.Open(nil, nonce, ciphertext, ad)
+}
+
+func (k *recordKeys) open13(seq uint64, record []byte) ([]byte, error) {
+	return k.aead.Open(nil, k.sequenceNonce(seq), record[recordHeaderLen:], record[:recordHeaderLen])
+}
+
+func (k *recordKeys) sequenceNonce(seq uint64) []byte {
+	nonce := bytes.Clone(k.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(seq >> (8 * i))
+	}
+	return nonce
+}
+
+// prf12 is the TLS 1.2 pseudorandom function from RFC 5246 section 5.
+func prf12(h func() hash.Hash, secret, label, seed []byte, n int) []byte {
+	labelSeed := append(bytes.Clone(label), seed...)
+	res := make([]byte, 0, n+h().Size())
+
+	a := labelSeed
+	for len(res) < n {
+		m := hmac.New(h, secret)
+		m.Write(a)
+		a = m.Sum(nil)
+
+		m = hmac.New(h, secret)
+		m.Write(a)
+		m.Write(labelSeed)
+		res = m.Sum(res)
+	}
+	return res[:n]
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label from RFC 8446 section 7.1 with an empty context.
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, n int) []byte {
+	full := "tls13 " + label
+	info := make([]byte, 0, 4+len(full))
+	info = binary.BigEndian.AppendUint16(info, uint16(n))
+	info = append(info, byte(len(full)))
+	info = append(info, full...)
+	info = append(info, 0)
+
+	// HKDF-Expand from RFC 5869
+	res := make([]byte, 0, n+h().Size())
+	var t []byte
+	for i := byte(1); len(res) < n; i++ {
+		m := hmac.New(h, secret)
+		m.Write(t)
+		m.Write(info)
+		m.Write([]byte{i})
+		t = m.Sum(nil)
+		res = append(res, t...)
+	}
+	return res[:n]
+}
@@ -0,0 +1,217 @@
+package httpassembly
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/reassembly"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedWrite struct {
+	dir     reassembly.TCPFlowDirection
+	payload []byte
+}
+
+// recorder captures what each end of a connection writes, in order.
+type recorder struct {
+	mu     sync.Mutex
+	writes []recordedWrite
+}
+
+type recordingConn struct {
+	net.Conn
+	dir reassembly.TCPFlowDirection
+	rec *recorder
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.rec.mu.Lock()
+	c.rec.writes = append(c.rec.writes, recordedWrite{dir: c.dir, payload: append([]byte(nil), p...)})
+	c.rec.mu.Unlock()
+	return c.Conn.Write(p)
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		DNSNames:     []string{"test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// recordTLSExchange runs n requests over a real TLS connection and returns the bytes
+// each side sent along with the key log written for it.
+func recordTLSExchange(t *testing.T, version uint16, suites []uint16, n int) ([]recordedWrite, string) {
+	keyLogFile := filepath.Join(t.TempDir(), "keylog")
+	w, err := os.Create(keyLogFile)
+	assert.Nil(t, err)
+	defer w.Close()
+
+	rec := &recorder{}
+	a, b := net.Pipe()
+	client := tls.Client(&recordingConn{Conn: a, dir: true, rec: rec}, &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         version,
+		MaxVersion:         version,
+		CipherSuites:       suites,
+		KeyLogWriter:       w,
+	})
+	server := tls.Server(&recordingConn{Conn: b, dir: false, rec: rec}, &tls.Config{
+		Certificates: []tls.Certificate{selfSignedCert(t)},
+		MinVersion:   version,
+		MaxVersion:   version,
+		CipherSuites: suites,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		br := bufio.NewReader(server)
+		for i := 0; i < n; i++ {
+			req, err := http.ReadRequest(br)
+			if err != nil {
+				return
+			}
+			req.Body.Close()
+			_, _ = server.Write([]byte(resA))
+		}
+	}()
+
+	br := bufio.NewReader(client)
+	for i := 0; i < n; i++ {
+		_, err = client.Write([]byte(reqA))
+		assert.Nil(t, err)
+		res, err := http.ReadResponse(br, nil)
+		assert.Nil(t, err)
+		_, _ = io.Copy(io.Discard, res.Body)
+	}
+	<-done
+	a.Close()
+	b.Close()
+
+	return rec.writes, keyLogFile
+}
+
+func testReassembleTLS(t *testing.T, version uint16, suites []uint16) {
+	writes, keyLogFile := recordTLSExchange(t, version, suites, 1)
+	keyLog, err := NewKeyLog(keyLogFile)
+	assert.Nil(t, err)
+
+	s, rec := newTestStream()
+	s.keyLog = keyLog
+	for _, w := range writes {
+		feed(s, w.dir, string(w.payload))
+	}
+
+	assert.Equal(t, []pair{{reqA, resA}}, rec.pairs)
+}
+
+func TestReassembleTLS12GCM(t *testing.T) {
+	testReassembleTLS(t, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256})
+}
+
+func TestReassembleTLS12GCM384(t *testing.T) {
+	testReassembleTLS(t, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384})
+}
+
+func TestReassembleTLS12ChaCha(t *testing.T) {
+	testReassembleTLS(t, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256})
+}
+
+func TestReassembleTLS13(t *testing.T) {
+	testReassembleTLS(t, tls.VersionTLS13, nil)
+}
+
+func TestReassembleTLSWithoutKeys(t *testing.T) {
+	writes, _ := recordTLSExchange(t, tls.VersionTLS13, nil, 1)
+	empty := filepath.Join(t.TempDir(), "keylog")
+	assert.Nil(t, os.WriteFile(empty, nil, 0o600))
+	keyLog, err := NewKeyLog(empty)
+	assert.Nil(t, err)
+
+	s, rec := newTestStream()
+	s.keyLog = keyLog
+	for _, w := range writes {
+		feed(s, w.dir, string(w.payload))
+	}
+
+	assert.Empty(t, rec.pairs)
+}
+
+func TestReassembleTLSKeysLoggedLate(t *testing.T) {
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		writes, keyLogFile := recordTLSExchange(t, version, nil, 2)
+		secrets, err := os.ReadFile(keyLogFile)
+		assert.Nil(t, err)
+
+		late := filepath.Join(t.TempDir(), "keylog")
+		assert.Nil(t, os.WriteFile(late, nil, 0o600))
+		keyLog, err := NewKeyLog(late)
+		assert.Nil(t, err)
+
+		s, rec := newTestStream()
+		s.keyLog = keyLog
+
+		// the first exchange goes by before the keys are logged, the second request is
+		// the client's last write
+		last := 0
+		for i, w := range writes {
+			if w.dir {
+				last = i
+			}
+		}
+		for _, w := range writes[:last] {
+			feed(s, w.dir, string(w.payload))
+		}
+		assert.Nil(t, os.WriteFile(late, secrets, 0o600))
+		for _, w := range writes[last:] {
+			feed(s, w.dir, string(w.payload))
+		}
+
+		assert.Equal(t, []pair{{reqA, resA}}, rec.pairs, tls.VersionName(version))
+	}
+}
+
+func TestKeyLogReloadsOnlyWhenChanged(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "keylog")
+	// a line still being written, finished below without changing the size
+	assert.Nil(t, os.WriteFile(fileName, []byte("CLIENT_RANDOM bb 02 "), 0o600))
+	keyLog, err := NewKeyLog(fileName)
+	assert.Nil(t, err)
+	st, err := os.Stat(fileName)
+	assert.Nil(t, err)
+
+	// same size and modification time, the file isn't read again
+	assert.Nil(t, os.WriteFile(fileName, []byte("CLIENT_RANDOM bb 02\n"), 0o600))
+	assert.Nil(t, os.Chtimes(fileName, st.ModTime(), st.ModTime()))
+	_, in := keyLog.secret(keyLogClientRandom, []byte{0xbb})
+	assert.False(t, in)
+
+	later := st.ModTime().Add(time.Second)
+	assert.Nil(t, os.Chtimes(fileName, later, later))
+	s, in := keyLog.secret(keyLogClientRandom, []byte{0xbb})
+	assert.True(t, in)
+	assert.Equal(t, []byte{0x02}, s)
+}
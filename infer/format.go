@@ -0,0 +1,160 @@
+package infer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	hostnameLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	topLevelLabel = regexp.MustCompile(`^[A-Za-z]{2,63}$`)
+	phonePattern  = regexp.MustCompile(`^\+?[0-9 ().-]+$`)
+	base64Pattern = regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)
+	jwtPart       = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// inferStringFormat guesses the format of a string. It's a guess from one sample,
+// merge drops it unless every other sample agrees.
+func inferStringFormat(s string) string {
+	switch {
+	case s == "":
+		return ""
+	case isUUID(s):
+		return "uuid"
+	case isDateTime(s):
+		return "date-time"
+	case isDate(s):
+		return "date"
+	case isIPv4(s):
+		return "ipv4"
+	case isIPv6(s):
+		return "ipv6"
+	case isEmail(s):
+		return "email"
+	case isJWT(s):
+		return "jwt"
+	case isURI(s):
+		return "uri"
+	case isHostname(s):
+		return "hostname"
+	case isPhone(s):
+		return "phone"
+	case isBase64(s):
+		return "byte"
+	}
+	return ""
+}
+
+func isUUID(s string) bool {
+	// uuid.Parse takes braces and urn prefixes too, only the usual form counts here
+	if len(s) != 36 {
+		return false
+	}
+	_, err := uuid.Parse(s)
+	return err == nil
+}
+
+func isDateTime(s string) bool {
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+func isDate(s string) bool {
+	_, err := time.Parse(time.DateOnly, s)
+	return err == nil
+}
+
+func isIPv4(s string) bool {
+	a, err := netip.ParseAddr(s)
+	return err == nil && a.Is4()
+}
+
+func isIPv6(s string) bool {
+	a, err := netip.ParseAddr(s)
+	return err == nil && a.Is6() && a.Zone() == ""
+}
+
+func isEmail(s string) bool {
+	a, err := mail.ParseAddress(s)
+	return err == nil && a.Address == s
+}
+
+// isJWT looks for three base64url parts where the first is a header naming an algorithm.
+func isJWT(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || !jwtPart.MatchString(parts[0]) || !jwtPart.MatchString(parts[1]) {
+		return false
+	}
+	if parts[2] != "" && !jwtPart.MatchString(parts[2]) {
+		return false
+	}
+
+	bs, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	return json.Unmarshal(bs, &header) == nil && header.Alg != ""
+}
+
+func isURI(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != "" && !strings.ContainsAny(s, " \t\n")
+}
+
+func isHostname(s string) bool {
+	if len(s) > 253 {
+		return false
+	}
+	labels := strings.Split(strings.TrimSuffix(s, "."), ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, l := range labels {
+		if !hostnameLabel.MatchString(l) {
+			return false
+		}
+	}
+	return topLevelLabel.MatchString(labels[len(labels)-1])
+}
+
+// isPhone matches numbers written like phone numbers, either E.164 with a leading +
+// or grouped with separators. A bare run of digits is more likely an id.
+func isPhone(s string) bool {
+	if !phonePattern.MatchString(s) {
+		return false
+	}
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	if digits < 7 || digits > 15 {
+		return false
+	}
+	return strings.HasPrefix(s, "+") || strings.ContainsAny(s, " ().-")
+}
+
+// isBase64 matches padded standard base64. Short strings and plain words happen to
+// be valid base64 too, so we want something that looks encoded.
+func isBase64(s string) bool {
+	if len(s) < 8 || len(s)%4 != 0 || !base64Pattern.MatchString(s) {
+		return false
+	}
+	if _, err := base64.StdEncoding.DecodeString(s); err != nil {
+		return false
+	}
+	return strings.ContainsAny(s, "+/=") || (strings.ContainsAny(s, "0123456789") &&
+		strings.ToLower(s) != s && strings.ToUpper(s) != s)
+}
@@ -1,6 +1,13 @@
 package infer
 
 import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/siegeai/siegelistener/merge"
 )
@@ -10,10 +17,15 @@ func NewObjectSchema(props map[string]*openapi3.Schema) *openapi3.Schema {
 	rs := make([]string, len(props))
 	i := 0
 	for k, v := range props {
+		if IsSensitiveName(k) {
+			ForgetValues(v)
+		}
 		ps[k] = v.NewRef()
 		rs[i] = k
 		i += 1
 	}
+	// in a fixed order, so samples with the same fields are the same json
+	sort.Strings(rs)
 	return &openapi3.Schema{
 		Type:       openapi3.TypeObject,
 		Required:   rs,
@@ -22,9 +34,10 @@ func NewObjectSchema(props map[string]*openapi3.Schema) *openapi3.Schema {
 }
 
 func NewArraySchema(elems []*openapi3.Schema) *openapi3.Schema {
+	var m merge.Merger
 	var item *openapi3.Schema
 	for _, e := range elems {
-		item = merge.Schema(item, e)
+		item = m.Schema(item, e)
 	}
 
 	var items *openapi3.SchemaRef
@@ -38,18 +51,149 @@ func NewArraySchema(elems []*openapi3.Schema) *openapi3.Schema {
 	}
 }
 
+// enumLike matches short words, the kind of value a status or a currency takes.
+var enumLike = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,31}$`)
+
+// sensitiveWords are the words in the names of fields whose values we never keep. A
+// name has to have one as a word of its own, so author or spin are fine.
+var sensitiveWords = map[string]bool{
+	"password": true, "passwd": true, "passphrase": true, "secret": true, "token": true,
+	"apikey": true, "privatekey": true, "ssn": true, "card": true, "auth": true,
+	"authorization": true, "session": true, "sessionid": true, "cookie": true, "pin": true,
+	"otp": true, "cvv": true, "cvc": true, "signature": true, "credential": true,
+}
+
+// NewStringSchema starts tracking s as a possible enum value when it looks like one,
+// merge decides whether the field really is an enum once it has seen enough samples.
+// A value that looks like personal data is marked as such instead, and never kept.
 func NewStringSchema(s string) *openapi3.Schema {
-	// especially interested in inferring the "format" property
-	// should look for things like uuid, email, various date formats
-	return &openapi3.Schema{
-		Type: openapi3.TypeString,
+	res := &openapi3.Schema{
+		Type:   openapi3.TypeString,
+		Format: inferStringFormat(s),
+	}
+	if kind := detectPII(s, res.Format); kind != "" {
+		res.Extensions = map[string]interface{}{merge.PIIExtension: kind}
+	} else if res.Format == "" && enumLike.MatchString(s) {
+		res.Extensions = merge.NewEnumTracking(s)
 	}
+	return res
 }
 
-func NewNumberSchema() *openapi3.Schema {
-	return &openapi3.Schema{
-		Type: openapi3.TypeNumber,
+// IsSensitiveName reports whether a field called name might hold credentials or
+// personal data.
+func IsSensitiveName(name string) bool {
+	words := nameWords(name)
+	for i, w := range words {
+		if isSensitiveWord(w) {
+			return true
+		}
+		// api_key, privateKey and the like
+		if i+1 < len(words) && isSensitiveWord(w+words[i+1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSensitiveWord(w string) bool {
+	return sensitiveWords[w] || sensitiveWords[strings.TrimSuffix(w, "s")]
+}
+
+// nameWords splits a name into its words, lowercased, whether it's written in
+// camelCase, snake_case, kebab-case or a mix of them. An acronym is a word of its own,
+// APIKey is api and key.
+func nameWords(name string) []string {
+	var words []string
+	var word []rune
+	rs := []rune(name)
+	for i, r := range rs {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = nil
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := rs[i-1]
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if !unicode.IsUpper(prev) || nextLower {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// ForgetValues stops s and anything in it from collecting enum values.
+func ForgetValues(s *openapi3.Schema) {
+	merge.StopEnumTracking(s)
+	if s.Items != nil && s.Items.Value != nil {
+		ForgetValues(s.Items.Value)
+	}
+	if s.AdditionalProperties.Schema != nil && s.AdditionalProperties.Schema.Value != nil {
+		ForgetValues(s.AdditionalProperties.Schema.Value)
+	}
+	for _, p := range s.Properties {
+		if p.Value != nil {
+			ForgetValues(p.Value)
+		}
+	}
+}
+
+// TrackNumberRange has number schemas record the smallest and largest values seen.
+// It's off by default, the values are real data and not always safe to keep.
+var TrackNumberRange = false
+
+// TrackIntegerEnums has integers collect their values as possible enums, the way
+// strings do. It's off by default for the same reason as TrackNumberRange, most
+// integers are ids and amounts.
+var TrackIntegerEnums = false
+
+// NewNumberSchema infers the schema of a number from its text. Numbers written without
+// a fraction or exponent are integers, merge widens them if a fraction shows up later.
+func NewNumberSchema(raw string) *openapi3.Schema {
+	s := &openapi3.Schema{Type: openapi3.TypeNumber}
+	if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		s.Type = openapi3.TypeInteger
+		if i >= math.MinInt32 && i <= math.MaxInt32 {
+			s.Format = "int32"
+		} else {
+			s.Format = "int64"
+		}
+		if TrackIntegerEnums {
+			// float64 so the values compare equal after a trip through json
+			s.Extensions = merge.NewEnumTracking(float64(i))
+		}
+	} else if !strings.ContainsAny(raw, ".eE") {
+		// too big for an int64, still an integer
+		s.Type = openapi3.TypeInteger
+	}
+
+	if TrackNumberRange {
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			s.Min = &f
+			s.Max = &f
+		}
+	}
+	return s
+}
+
+// NewFieldNumberSchema is NewNumberSchema for the value of a field called name. Plenty
+// of ids are nine or ten digits, so a number is only taken for a card, SSN or phone
+// number when the name says so too. Neither the value nor the range of one is kept.
+func NewFieldNumberSchema(name, raw string) *openapi3.Schema {
+	s := NewNumberSchema(raw)
+	if kind := detectNumericPII(raw); kind != "" && piiNames[kind].MatchString(name) {
+		s.Extensions = map[string]interface{}{merge.PIIExtension: kind}
+		s.Min, s.Max = nil, nil
 	}
+	return s
 }
 
 func NewBooleanSchema(b bool) *openapi3.Schema {
@@ -58,8 +202,9 @@ func NewBooleanSchema(b bool) *openapi3.Schema {
 	}
 }
 
+// NewNullSchema is what a null tells us, that the value can be null and nothing about
+// its type. Merging it with any other schema makes that schema nullable.
 func NewNullSchema() *openapi3.Schema {
-	// Is this actually the right way to represent this?
 	return &openapi3.Schema{
 		Nullable: true,
 	}
@@ -0,0 +1,51 @@
+package infer
+
+import (
+	"testing"
+
+	"github.com/siegeai/siegelistener/merge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSensitiveName(t *testing.T) {
+	cases := map[string]bool{
+		"password":        true,
+		"newPassword":     true,
+		"api_key":         true,
+		"apiKey":          true,
+		"X-API-Key":       true,
+		"APIKey":          true,
+		"accessToken":     true,
+		"refresh_tokens":  true,
+		"Authorization":   true,
+		"x-auth-token":    true,
+		"cardNumber":      true,
+		"credit_card":     true,
+		"ssn":             true,
+		"pin":             true,
+		"otpCode":         true,
+		"session_id":      true,
+		"client_secret":   true,
+		"author":          false,
+		"discard":         false,
+		"classname":       false,
+		"footprint":       false,
+		"spin":            false,
+		"status":          false,
+		"cardinality":     false,
+		"authorName":      false,
+		"passenger_count": false,
+	}
+	for name, want := range cases {
+		assert.Equal(t, want, IsSensitiveName(name), name)
+	}
+}
+
+func TestForgetValuesInMaps(t *testing.T) {
+	s, err := ParseSampleBodyBytes([]byte(`{"tokens": {"2023-10-01": "active", "2023-10-02": "active"}}`))
+	assert.Nil(t, err)
+
+	tokens := s.Properties["tokens"].Value
+	assert.NotNil(t, tokens.AdditionalProperties.Schema)
+	assert.NotContains(t, tokens.AdditionalProperties.Schema.Value.Extensions, merge.EnumValuesExtension)
+}
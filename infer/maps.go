@@ -0,0 +1,112 @@
+package infer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/merge"
+	"github.com/siegeai/siegelistener/pathtemplate"
+)
+
+// minSameShapeKeys is how many keys with values of the same shape an object needs
+// before we decide it's a map rather than a record that happens to repeat itself.
+const minSameShapeKeys = 4
+
+var keyClassifiers = pathtemplate.DefaultClassifiers()
+
+// isMapLike guesses whether an object is a dictionary, keyed by something like a user
+// id or a date, rather than a record with a fixed set of fields. Treating a map as a
+// record gives a property for every key ever seen, all of them required.
+func isMapLike(props map[string]*openapi3.Schema) bool {
+	if len(props) == 0 {
+		return false
+	}
+	if allKeysLikeValues(props) {
+		return true
+	}
+	return len(props) >= minSameShapeKeys && allSameCompositeShape(props)
+}
+
+func allKeysLikeValues(props map[string]*openapi3.Schema) bool {
+	for k := range props {
+		if !isValueLike(k) {
+			return false
+		}
+	}
+	return true
+}
+
+func isValueLike(key string) bool {
+	for _, c := range keyClassifiers {
+		if _, _, ok := c.Classify(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allSameCompositeShape reports whether every value is an object or array with the same
+// structure. Plain values sharing a type says nothing, most records are mostly strings.
+func allSameCompositeShape(props map[string]*openapi3.Schema) bool {
+	shape := ""
+	for _, v := range props {
+		if v.Type != openapi3.TypeObject && v.Type != openapi3.TypeArray {
+			return false
+		}
+		s := shapeOf(v)
+		if shape != "" && s != shape {
+			return false
+		}
+		shape = s
+	}
+	return true
+}
+
+// shapeOf describes the structure of a schema, its types and property names.
+func shapeOf(s *openapi3.Schema) string {
+	if s == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(s.Type)
+	switch {
+	case s.Items != nil:
+		b.WriteString("[" + shapeOf(s.Items.Value) + "]")
+	case s.AdditionalProperties.Schema != nil:
+		b.WriteString("{*:" + shapeOf(s.AdditionalProperties.Schema.Value) + "}")
+	case len(s.Properties) > 0:
+		keys := make([]string, 0, len(s.Properties))
+		for k := range s.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("{")
+		for _, k := range keys {
+			b.WriteString(k + ":" + shapeOf(s.Properties[k].Value) + ",")
+		}
+		b.WriteString("}")
+	}
+	return b.String()
+}
+
+// NewMapSchema is an object with any keys, each value described by the merge of props.
+func NewMapSchema(props map[string]*openapi3.Schema) *openapi3.Schema {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var m merge.Merger
+	var value *openapi3.Schema
+	for _, k := range keys {
+		value = m.Schema(value, props[k])
+	}
+	return &openapi3.Schema{
+		Type:                 openapi3.TypeObject,
+		AdditionalProperties: openapi3.AdditionalProperties{Schema: value.NewRef()},
+	}
+}
@@ -40,10 +40,15 @@ func parseFastJsonValue(v *fastjson.Value) (*openapi3.Schema, error) {
 		}
 		return parseFastJsonArray(a)
 	case fastjson.TypeString:
-		s := v.String()
-		return parseFastJsonString(s)
+		// String would give us the quoted json, we want the value
+		bs, err := v.StringBytes()
+		if err != nil {
+			return nil, err
+		}
+		return parseFastJsonString(string(bs))
 	case fastjson.TypeNumber:
-		return parseFastJsonNumber()
+		// String gives back the number as it was written
+		return parseFastJsonNumber(v.String())
 	case fastjson.TypeTrue:
 		return parseFastJsonBool(true)
 	case fastjson.TypeFalse:
@@ -63,7 +68,14 @@ func parseFastJsonObject(o *fastjson.Object) (*openapi3.Schema, error) {
 		if visitErr != nil {
 			return
 		}
-		child, childErr := parseFastJsonValue(v)
+		var child *openapi3.Schema
+		var childErr error
+		if v.Type() == fastjson.TypeNumber {
+			// the key is what tells an id from a phone number
+			child = NewFieldNumberSchema(string(key), v.String())
+		} else {
+			child, childErr = parseFastJsonValue(v)
+		}
 		if childErr != nil {
 			visitErr = childErr
 			return
@@ -76,6 +88,9 @@ func parseFastJsonObject(o *fastjson.Object) (*openapi3.Schema, error) {
 		return nil, visitErr
 	}
 
+	if isMapLike(ps) {
+		return NewMapSchema(ps), nil
+	}
 	return NewObjectSchema(ps), nil
 }
 
@@ -95,8 +110,8 @@ func parseFastJsonString(s string) (*openapi3.Schema, error) {
 	return NewStringSchema(s), nil
 }
 
-func parseFastJsonNumber() (*openapi3.Schema, error) {
-	return NewNumberSchema(), nil
+func parseFastJsonNumber(raw string) (*openapi3.Schema, error) {
+	return NewNumberSchema(raw), nil
 }
 
 func parseFastJsonBool(b bool) (*openapi3.Schema, error) {
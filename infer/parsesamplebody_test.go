@@ -3,6 +3,8 @@ package infer
 import (
 	"testing"
 
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/merge"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -38,7 +40,7 @@ func TestParseObjectOneFieldNull(t *testing.T) {
 	bs := []byte(`{"field": null}`)
 	s, err := ParseSampleBodyBytes(bs)
 	assert.Nil(t, err)
-	assert.NotNil(t, s)
+	assert.True(t, s.Properties["field"].Value.Nullable)
 }
 
 func TestParseArrayEmpty(t *testing.T) {
@@ -52,12 +54,123 @@ func TestParseArrayCompositeHomogeneous(t *testing.T) {
 	bs := []byte(`[{"a": 123}, {"b": "hi"}]`)
 	s, err := ParseSampleBodyBytes(bs)
 	assert.Nil(t, err)
-	assert.NotNil(t, s)
+	item := s.Items.Value
+	assert.Equal(t, openapi3.TypeObject, item.Type)
+	assert.Len(t, item.Properties, 2)
+	assert.Empty(t, item.Required)
 }
 
 func TestParseArrayCompositeHeterogeneous(t *testing.T) {
 	bs := []byte(`[{"a": 123}, null]`)
 	s, err := ParseSampleBodyBytes(bs)
 	assert.Nil(t, err)
-	assert.NotNil(t, s)
+	item := s.Items.Value
+	assert.Equal(t, openapi3.TypeObject, item.Type)
+	assert.True(t, item.Nullable)
+	assert.Empty(t, item.OneOf)
+	assert.Equal(t, openapi3.TypeInteger, item.Properties["a"].Value.Type)
+}
+
+func TestParseArrayOnlyNulls(t *testing.T) {
+	s, err := ParseSampleBodyBytes([]byte(`[null, null]`))
+	assert.Nil(t, err)
+	assert.Equal(t, openapi3.TypeArray, s.Type)
+	assert.True(t, s.Items.Value.Nullable)
+
+	// a later sample fills in the type
+	t2, err := ParseSampleBodyBytes([]byte(`[1]`))
+	assert.Nil(t, err)
+	item := new(merge.Merger).Schema(s, t2).Items.Value
+	assert.Equal(t, openapi3.TypeInteger, item.Type)
+	assert.True(t, item.Nullable)
+}
+
+func TestParseNumbers(t *testing.T) {
+	s, err := ParseSampleBodyBytes([]byte(`{"small": 12, "big": 12345678901, "huge": 123456789012345678901234, "real": 1.5, "exp": 1e3}`))
+	assert.Nil(t, err)
+
+	small := s.Properties["small"].Value
+	assert.Equal(t, openapi3.TypeInteger, small.Type)
+	assert.Equal(t, "int32", small.Format)
+	assert.Nil(t, small.Min)
+
+	big := s.Properties["big"].Value
+	assert.Equal(t, openapi3.TypeInteger, big.Type)
+	assert.Equal(t, "int64", big.Format)
+
+	assert.Equal(t, openapi3.TypeInteger, s.Properties["huge"].Value.Type)
+	assert.Equal(t, openapi3.TypeNumber, s.Properties["real"].Value.Type)
+	assert.Equal(t, openapi3.TypeNumber, s.Properties["exp"].Value.Type)
+}
+
+func TestParseNumbersWiden(t *testing.T) {
+	s, err := ParseSampleBodyBytes([]byte(`[1, 12345678901]`))
+	assert.Nil(t, err)
+	assert.Equal(t, openapi3.TypeInteger, s.Items.Value.Type)
+	assert.Equal(t, "int64", s.Items.Value.Format)
+
+	s, err = ParseSampleBodyBytes([]byte(`[1, 2.5]`))
+	assert.Nil(t, err)
+	assert.Equal(t, openapi3.TypeNumber, s.Items.Value.Type)
+	assert.Equal(t, "", s.Items.Value.Format)
+}
+
+func TestParseNumbersRange(t *testing.T) {
+	TrackNumberRange = true
+	defer func() { TrackNumberRange = false }()
+
+	s, err := ParseSampleBodyBytes([]byte(`[3, -1, 2.5]`))
+	assert.Nil(t, err)
+	assert.Equal(t, -1.0, *s.Items.Value.Min)
+	assert.Equal(t, 3.0, *s.Items.Value.Max)
+}
+
+func TestParseEnumCandidates(t *testing.T) {
+	s, err := ParseSampleBodyBytes([]byte(`{"status": "active", "code": 3, "password": "hunter2", "user": {"api_key": "abc"}}`))
+	assert.Nil(t, err)
+
+	ps := s.Properties
+	assert.Equal(t, []interface{}{"active"}, ps["status"].Value.Extensions[merge.EnumValuesExtension])
+	assert.Nil(t, ps["code"].Value.Extensions)
+	assert.Nil(t, ps["password"].Value.Extensions)
+	assert.Nil(t, ps["user"].Value.Properties["api_key"].Value.Extensions)
+
+	TrackIntegerEnums = true
+	defer func() { TrackIntegerEnums = false }()
+	s, err = ParseSampleBodyBytes([]byte(`{"code": 3}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{float64(3)}, s.Properties["code"].Value.Extensions[merge.EnumValuesExtension])
+}
+
+func TestParseMapByKeys(t *testing.T) {
+	s, err := ParseSampleBodyBytes([]byte(`{"1042": {"name": "a"}, "2093": {"name": "b", "age": 3}}`))
+	assert.Nil(t, err)
+	assert.Empty(t, s.Properties)
+	assert.NotNil(t, s.AdditionalProperties.Schema)
+	assert.Contains(t, s.AdditionalProperties.Schema.Value.Properties, "age")
+	assert.Equal(t, []string{"name"}, s.AdditionalProperties.Schema.Value.Required)
+
+	s, err = ParseSampleBodyBytes([]byte(`{"2023-10-01": 4, "2023-10-02": 5}`))
+	assert.Nil(t, err)
+	assert.Equal(t, openapi3.TypeInteger, s.AdditionalProperties.Schema.Value.Type)
+}
+
+func TestParseMapByShape(t *testing.T) {
+	s, err := ParseSampleBodyBytes([]byte(`{"alice": {"n": 1}, "bob": {"n": 2}, "carol": {"n": 3}, "dave": {"n": 4}}`))
+	assert.Nil(t, err)
+	assert.Empty(t, s.Properties)
+	assert.NotNil(t, s.AdditionalProperties.Schema)
+}
+
+func TestParseRecordNotMap(t *testing.T) {
+	s, err := ParseSampleBodyBytes([]byte(`{"id": 1, "name": "a", "email": "a@example.com", "role": "admin"}`))
+	assert.Nil(t, err)
+	assert.Len(t, s.Properties, 4)
+	assert.Nil(t, s.AdditionalProperties.Schema)
+
+	// keys that are long slugs aren't tokens
+	s, err = ParseSampleBodyBytes([]byte(`{"ec2-instance-types": ["t3"], "oauth2-authorization": true}`))
+	assert.Nil(t, err)
+	assert.Len(t, s.Properties, 2)
+	assert.Nil(t, s.AdditionalProperties.Schema)
 }
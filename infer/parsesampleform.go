@@ -0,0 +1,110 @@
+package infer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// ParseSampleFormBytes infers a schema from an application/x-www-form-urlencoded
+// body. Every value is a string on the wire, a key sent more than once is an array.
+func ParseSampleFormBytes(b []byte) (*openapi3.Schema, error) {
+	vs, err := url.ParseQuery(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]*openapi3.Schema, len(vs))
+	for k, v := range vs {
+		if len(v) == 1 {
+			props[k] = NewStringSchema(v[0])
+			continue
+		}
+		items := make([]*openapi3.Schema, len(v))
+		for i := range v {
+			items[i] = NewStringSchema(v[i])
+		}
+		props[k] = NewArraySchema(items)
+	}
+	return NewObjectSchema(props), nil
+}
+
+// ParseSampleMultipartBytes infers a schema from a multipart/form-data body. File
+// parts become binary strings, parts that carry JSON are inferred like any other JSON
+// body, and the content type of each part that declared one goes into the encoding.
+func ParseSampleMultipartBytes(b []byte, boundary string) (*openapi3.Schema, map[string]*openapi3.Encoding, error) {
+	r := multipart.NewReader(bytes.NewReader(b), boundary)
+
+	parts := make(map[string][]*openapi3.Schema)
+	encoding := make(map[string]*openapi3.Encoding)
+	for {
+		p, err := r.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := p.FormName()
+		if name == "" {
+			continue
+		}
+
+		s, err := parseMultipartPart(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		parts[name] = append(parts[name], s)
+
+		if ct := p.Header.Get("Content-Type"); ct != "" {
+			e := openapi3.NewEncoding()
+			e.ContentType = MediaTypeKey(ct)
+			encoding[name] = e
+		}
+	}
+
+	props := make(map[string]*openapi3.Schema, len(parts))
+	for k, ss := range parts {
+		if len(ss) == 1 {
+			props[k] = ss[0]
+		} else {
+			props[k] = NewArraySchema(ss)
+		}
+	}
+	return NewObjectSchema(props), encoding, nil
+}
+
+func parseMultipartPart(p *multipart.Part) (*openapi3.Schema, error) {
+	if p.FileName() != "" {
+		return &openapi3.Schema{Type: openapi3.TypeString, Format: "binary"}, nil
+	}
+
+	body, err := io.ReadAll(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(p.Header.Get("Content-Type"), "json") {
+		if s, err := ParseSampleBodyBytes(body); err == nil {
+			return s, nil
+		}
+	}
+	return NewStringSchema(string(body)), nil
+}
+
+// MediaTypeKey strips the parameters off a Content-Type, so that a charset or a
+// multipart boundary doesn't end up as a media type of its own.
+func MediaTypeKey(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mt
+}
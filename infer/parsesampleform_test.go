@@ -0,0 +1,54 @@
+package infer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseForm(t *testing.T) {
+	s, err := ParseSampleFormBytes([]byte("name=alice&tag=a&tag=b"))
+	assert.Nil(t, err)
+	assert.Equal(t, openapi3.TypeObject, s.Type)
+	assert.Equal(t, openapi3.TypeString, s.Properties["name"].Value.Type)
+	assert.Equal(t, openapi3.TypeArray, s.Properties["tag"].Value.Type)
+	assert.Equal(t, openapi3.TypeString, s.Properties["tag"].Value.Items.Value.Type)
+}
+
+func TestParseMultipart(t *testing.T) {
+	body := strings.Join([]string{
+		"--xyz",
+		`Content-Disposition: form-data; name="name"`,
+		"",
+		"alice",
+		"--xyz",
+		`Content-Disposition: form-data; name="meta"`,
+		"Content-Type: application/json",
+		"",
+		`{"size": 3}`,
+		"--xyz",
+		`Content-Disposition: form-data; name="avatar"; filename="a.png"`,
+		"Content-Type: image/png",
+		"",
+		"\x89PNG",
+		"--xyz--",
+		"",
+	}, "\r\n")
+
+	s, enc, err := ParseSampleMultipartBytes([]byte(body), "xyz")
+	assert.Nil(t, err)
+	assert.Equal(t, openapi3.TypeString, s.Properties["name"].Value.Type)
+	assert.Equal(t, openapi3.TypeObject, s.Properties["meta"].Value.Type)
+	assert.Equal(t, openapi3.TypeInteger, s.Properties["meta"].Value.Properties["size"].Value.Type)
+	assert.Equal(t, "binary", s.Properties["avatar"].Value.Format)
+	assert.Equal(t, "image/png", enc["avatar"].ContentType)
+	assert.Equal(t, "application/json", enc["meta"].ContentType)
+	assert.NotContains(t, enc, "name")
+}
+
+func TestMediaTypeKey(t *testing.T) {
+	assert.Equal(t, "multipart/form-data", MediaTypeKey("multipart/form-data; boundary=xyz"))
+	assert.Equal(t, "application/json", MediaTypeKey("application/json; charset=utf-8"))
+}
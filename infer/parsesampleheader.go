@@ -0,0 +1,11 @@
+package infer
+
+import "github.com/getkin/kin-openapi/openapi3"
+
+// ParseSampleHeaderValue infers the type of a header value the same way as a query
+// value, except header values are too often credentials to ever keep as an enum.
+func ParseSampleHeaderValue(v string) *openapi3.Schema {
+	s := ParseSampleQueryValue(v)
+	ForgetValues(s)
+	return s
+}
@@ -0,0 +1,35 @@
+package infer
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// ParseSampleQueryValues infers the schema of a query parameter from every value it
+// was given in one request. A key given more than once is an array.
+func ParseSampleQueryValues(vs []string) *openapi3.Schema {
+	if len(vs) == 1 {
+		return ParseSampleQueryValue(vs[0])
+	}
+
+	items := make([]*openapi3.Schema, len(vs))
+	for i, v := range vs {
+		items[i] = ParseSampleQueryValue(v)
+	}
+	return NewArraySchema(items)
+}
+
+// ParseSampleQueryValue infers the type of a single query value. Everything in a query
+// string is text, so this guesses at what the text was before it was encoded.
+func ParseSampleQueryValue(v string) *openapi3.Schema {
+	if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) && !strings.ContainsAny(v, "xXpP_") {
+		return NewNumberSchema(v)
+	}
+	if strings.EqualFold(v, "true") || strings.EqualFold(v, "false") {
+		return &openapi3.Schema{Type: openapi3.TypeBoolean}
+	}
+	return NewStringSchema(v)
+}
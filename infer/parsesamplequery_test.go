@@ -0,0 +1,30 @@
+package infer
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/merge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQueryValue(t *testing.T) {
+	assert.Equal(t, openapi3.TypeInteger, ParseSampleQueryValue("42").Type)
+	assert.Equal(t, openapi3.TypeNumber, ParseSampleQueryValue("4.2").Type)
+	assert.Equal(t, openapi3.TypeBoolean, ParseSampleQueryValue("true").Type)
+	assert.Equal(t, "date", ParseSampleQueryValue("2023-10-01").Format)
+	assert.Equal(t, "date-time", ParseSampleQueryValue("2023-10-01T12:00:00Z").Format)
+	assert.Equal(t, []interface{}{"desc"}, ParseSampleQueryValue("desc").Extensions[merge.EnumValuesExtension])
+
+	s := ParseSampleQueryValue("hello world")
+	assert.Equal(t, openapi3.TypeString, s.Type)
+	assert.Nil(t, s.Extensions)
+
+	assert.Equal(t, openapi3.TypeString, ParseSampleQueryValue("NaN").Type)
+}
+
+func TestParseQueryValuesRepeated(t *testing.T) {
+	s := ParseSampleQueryValues([]string{"1", "2"})
+	assert.Equal(t, openapi3.TypeArray, s.Type)
+	assert.Equal(t, openapi3.TypeInteger, s.Items.Value.Type)
+}
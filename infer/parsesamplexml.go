@@ -0,0 +1,126 @@
+package infer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var (
+	ErrXMLNoRoot    = errors.New("xml document has no root element")
+	ErrXMLManyRoots = errors.New("xml document has more than one root element")
+)
+
+// xmlNode is just enough of an element to infer a schema from.
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// ParseSampleXMLBytes infers a schema from an XML document. Elements with children or
+// attributes are objects, anything else is a string, an element repeated under the
+// same parent is an array and attributes are marked as such in the schema's xml.
+func ParseSampleXMLBytes(b []byte) (*openapi3.Schema, error) {
+	root, err := parseXMLTree(b)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newXMLNodeSchema(root)
+	s.XML = &openapi3.XML{Name: root.name.Local, Namespace: root.name.Space}
+	return s, nil
+}
+
+func parseXMLTree(b []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	// the charset is in the Content-Type already, we only care about element names
+	d.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name, attrs: t.Attr}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, ErrXMLManyRoots
+				}
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, ErrXMLNoRoot
+	}
+	return root, nil
+}
+
+func newXMLNodeSchema(n *xmlNode) *openapi3.Schema {
+	attrs := xmlAttrs(n.attrs)
+	if len(n.children) == 0 && len(attrs) == 0 {
+		return NewStringSchema(strings.TrimSpace(n.text.String()))
+	}
+
+	props := make(map[string]*openapi3.Schema)
+	for _, a := range attrs {
+		s := NewStringSchema(a.Value)
+		s.XML = &openapi3.XML{Attribute: true}
+		props[a.Name.Local] = s
+	}
+
+	samples := make(map[string][]*openapi3.Schema)
+	for _, c := range n.children {
+		samples[c.name.Local] = append(samples[c.name.Local], newXMLNodeSchema(c))
+	}
+
+	for name, ss := range samples {
+		if len(ss) == 1 {
+			props[name] = ss[0]
+			continue
+		}
+		a := NewArraySchema(ss)
+		// repeated elements sit directly in the parent, there's no wrapping element
+		a.XML = &openapi3.XML{Name: name}
+		props[name] = a
+	}
+
+	return NewObjectSchema(props)
+}
+
+// xmlAttrs drops namespace declarations, they're not part of the data.
+func xmlAttrs(as []xml.Attr) []xml.Attr {
+	var res []xml.Attr
+	for _, a := range as {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		res = append(res, a)
+	}
+	return res
+}
@@ -0,0 +1,45 @@
+package infer
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseXML(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<user xmlns="urn:example" id="7">
+  <name>alice</name>
+  <tag>a</tag>
+  <tag>b</tag>
+  <address><city>Paris</city></address>
+</user>`
+
+	s, err := ParseSampleXMLBytes([]byte(doc))
+	assert.Nil(t, err)
+	assert.Equal(t, openapi3.TypeObject, s.Type)
+	assert.Equal(t, "user", s.XML.Name)
+	assert.Equal(t, "urn:example", s.XML.Namespace)
+	assert.NotContains(t, s.Properties, "xmlns")
+
+	id := s.Properties["id"].Value
+	assert.Equal(t, openapi3.TypeString, id.Type)
+	assert.True(t, id.XML.Attribute)
+
+	assert.Equal(t, openapi3.TypeString, s.Properties["name"].Value.Type)
+	assert.Equal(t, openapi3.TypeArray, s.Properties["tag"].Value.Type)
+	assert.Equal(t, openapi3.TypeString, s.Properties["tag"].Value.Items.Value.Type)
+	assert.Equal(t, openapi3.TypeString, s.Properties["address"].Value.Properties["city"].Value.Type)
+}
+
+func TestParseXMLErrors(t *testing.T) {
+	_, err := ParseSampleXMLBytes([]byte(""))
+	assert.ErrorIs(t, err, ErrXMLNoRoot)
+
+	_, err = ParseSampleXMLBytes([]byte("<a/><b/>"))
+	assert.ErrorIs(t, err, ErrXMLManyRoots)
+
+	_, err = ParseSampleXMLBytes([]byte("<a><b></a>"))
+	assert.NotNil(t, err)
+}
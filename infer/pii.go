@@ -0,0 +1,143 @@
+package infer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The kinds of personal data and credentials we look for, the value of
+// merge.PIIExtension on a field where one turned up.
+const (
+	PIIEmail  = "email"
+	PIICard   = "card"
+	PIISSN    = "ssn"
+	PIIPhone  = "phone"
+	PIIIBAN   = "iban"
+	PIIJWT    = "jwt"
+	PIIAPIKey = "api_key"
+)
+
+var (
+	ssnPattern  = regexp.MustCompile(`^(\d{3})-(\d{2})-(\d{4})$`)
+	cardPattern = regexp.MustCompile(`^[2-6][0-9 -]{11,21}[0-9]$`)
+	// nanpPattern matches North American phone numbers written as bare digits, area
+	// codes and exchanges never start with 0 or 1, which leaves out unix timestamps
+	nanpPattern = regexp.MustCompile(`^1?[2-9][0-9]{2}[2-9][0-9]{6}$`)
+	// piiNames are the field names that back up a bare number looking like personal data
+	piiNames = map[string]*regexp.Regexp{
+		PIICard:  regexp.MustCompile(`(?i)card|ccn|cc_?num|^pan$|_pan$`),
+		PIISSN:   regexp.MustCompile(`(?i)ssn|social_?sec`),
+		PIIPhone: regexp.MustCompile(`(?i)phone|mobile|msisdn|^tel|_tel$|fax`),
+	}
+	ibanPattern = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	// apiKeyPattern matches the prefixed keys of well known providers, a random
+	// looking string on its own could just as well be an id.
+	apiKeyPattern = regexp.MustCompile(`^(` +
+		`[spr]k_(live|test)_[A-Za-z0-9]{16,}` + // stripe
+		`|AKIA[0-9A-Z]{16}` + // aws
+		`|gh[pousr]_[A-Za-z0-9]{36,}` + // github
+		`|xox[abprs]-[A-Za-z0-9-]{10,}` + // slack
+		`|AIza[0-9A-Za-z_-]{35}` + // google
+		`|glpat-[A-Za-z0-9_-]{20,}` + // gitlab
+		`|sk-[A-Za-z0-9_-]{20,}` +
+		`)$`)
+)
+
+// detectPII returns the kind of personal data or credential s looks like, or "" when
+// it doesn't look like any. format is what inferStringFormat made of s.
+func detectPII(s, format string) string {
+	switch {
+	case apiKeyPattern.MatchString(s):
+		return PIIAPIKey
+	case isSSN(s):
+		return PIISSN
+	case isCardNumber(s):
+		return PIICard
+	case isIBAN(s):
+		return PIIIBAN
+	}
+
+	switch format {
+	case "email":
+		return PIIEmail
+	case "jwt":
+		return PIIJWT
+	case "phone":
+		return PIIPhone
+	}
+	return ""
+}
+
+// detectNumericPII is detectPII for the text of a number. There are no separators to
+// go on, so SSNs and phone numbers are recognised by their digits alone, which isn't
+// enough on its own, see NewFieldNumberSchema.
+func detectNumericPII(raw string) string {
+	switch {
+	case isCardNumber(raw):
+		return PIICard
+	case len(raw) == 9 && isSSN(raw[:3]+"-"+raw[3:5]+"-"+raw[5:]):
+		return PIISSN
+	case nanpPattern.MatchString(raw):
+		return PIIPhone
+	}
+	return ""
+}
+
+// isSSN matches US social security numbers, leaving out the ranges that are never
+// issued.
+func isSSN(s string) bool {
+	m := ssnPattern.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	area, group, serial := m[1], m[2], m[3]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// isCardNumber matches payment card numbers, grouped or not, that pass the Luhn check.
+func isCardNumber(s string) bool {
+	if !cardPattern.MatchString(s) {
+		return false
+	}
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	return luhn(digits)
+}
+
+func luhn(digits string) bool {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// isIBAN matches international bank account numbers, grouped in fours or not, that
+// pass the mod 97 check.
+func isIBAN(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if !ibanPattern.MatchString(s) {
+		return false
+	}
+
+	// the country and check digits go to the end and letters count as two digits,
+	// A is 10, and the whole thing is 1 mod 97
+	rem := 0
+	for _, r := range s[4:] + s[:4] {
+		if r >= 'A' && r <= 'Z' {
+			rem = (rem*100 + int(r-'A') + 10) % 97
+		} else {
+			rem = (rem*10 + int(r-'0')) % 97
+		}
+	}
+	return rem == 1
+}
@@ -0,0 +1,238 @@
+package infer
+
+import (
+	"errors"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var ErrProtobufTooDeep = errors.New("protobuf message nested too deeply")
+
+// maxProtobufDepth bounds how far we follow nested messages. Without a descriptor any
+// bytes field might be a message so this keeps guessing cheap.
+const maxProtobufDepth = 32
+
+// ParseSampleProtobuf infers a schema from a protobuf message in wire format. Without
+// a descriptor all we know are wire types, so fields are named by their number and
+// length-delimited fields are guessed to be strings, bytes or nested messages.
+func ParseSampleProtobuf(b []byte, md protoreflect.MessageDescriptor) (*openapi3.Schema, error) {
+	return parseProtobufMessage(b, md, 0)
+}
+
+func parseProtobufMessage(b []byte, md protoreflect.MessageDescriptor, depth int) (*openapi3.Schema, error) {
+	if depth > maxProtobufDepth {
+		return nil, ErrProtobufTooDeep
+	}
+
+	samples := make(map[string][]*openapi3.Schema)
+	lists := make(map[string]bool)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var fd protoreflect.FieldDescriptor
+		if md != nil {
+			fd = md.Fields().ByNumber(num)
+		}
+
+		s, n, err := parseProtobufField(b, num, typ, fd, depth)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+
+		name := protobufFieldName(num, fd)
+		samples[name] = append(samples[name], s)
+		if fd != nil && fd.IsList() {
+			lists[name] = true
+		}
+	}
+
+	props := make(map[string]*openapi3.Schema, len(samples))
+	for name, ss := range samples {
+		if len(ss) > 1 || lists[name] {
+			props[name] = NewArraySchema(flattenPacked(ss))
+		} else {
+			props[name] = ss[0]
+		}
+	}
+
+	return NewObjectSchema(props), nil
+}
+
+// flattenPacked unwraps packed chunks of a repeated field so they merge with any
+// elements sent unpacked.
+func flattenPacked(ss []*openapi3.Schema) []*openapi3.Schema {
+	res := make([]*openapi3.Schema, 0, len(ss))
+	for _, s := range ss {
+		if s.Type == openapi3.TypeArray && s.Items != nil && s.Items.Value.Type != openapi3.TypeObject {
+			res = append(res, s.Items.Value)
+		} else {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func parseProtobufField(b []byte, num protowire.Number, typ protowire.Type, fd protoreflect.FieldDescriptor, depth int) (*openapi3.Schema, int, error) {
+	switch typ {
+	case protowire.VarintType:
+		_, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, 0, protowire.ParseError(n)
+		}
+		return protobufVarintSchema(fd), n, nil
+
+	case protowire.Fixed32Type:
+		_, n := protowire.ConsumeFixed32(b)
+		if n < 0 {
+			return nil, 0, protowire.ParseError(n)
+		}
+		return protobufFixedSchema(fd, "fixed32"), n, nil
+
+	case protowire.Fixed64Type:
+		_, n := protowire.ConsumeFixed64(b)
+		if n < 0 {
+			return nil, 0, protowire.ParseError(n)
+		}
+		return protobufFixedSchema(fd, "fixed64"), n, nil
+
+	case protowire.BytesType:
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return nil, 0, protowire.ParseError(n)
+		}
+		s, err := protobufBytesSchema(v, fd, depth)
+		if err != nil {
+			return nil, 0, err
+		}
+		return s, n, nil
+
+	case protowire.StartGroupType:
+		v, n := protowire.ConsumeGroup(num, b)
+		if n < 0 {
+			return nil, 0, protowire.ParseError(n)
+		}
+		var md protoreflect.MessageDescriptor
+		if fd != nil {
+			md = fd.Message()
+		}
+		s, err := parseProtobufMessage(v, md, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return s, n, nil
+	}
+
+	return nil, 0, protowire.ParseError(-1)
+}
+
+func protobufFieldName(num protowire.Number, fd protoreflect.FieldDescriptor) string {
+	if fd != nil {
+		return string(fd.Name())
+	}
+	return strconv.Itoa(int(num))
+}
+
+func protobufVarintSchema(fd protoreflect.FieldDescriptor) *openapi3.Schema {
+	if fd == nil {
+		return &openapi3.Schema{Type: openapi3.TypeInteger}
+	}
+
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return &openapi3.Schema{Type: openapi3.TypeBoolean}
+	case protoreflect.EnumKind:
+		return protobufEnumSchema(fd.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Uint32Kind:
+		return &openapi3.Schema{Type: openapi3.TypeInteger, Format: "int32"}
+	default:
+		return &openapi3.Schema{Type: openapi3.TypeInteger, Format: "int64"}
+	}
+}
+
+func protobufEnumSchema(ed protoreflect.EnumDescriptor) *openapi3.Schema {
+	vs := ed.Values()
+	enum := make([]interface{}, vs.Len())
+	for i := 0; i < vs.Len(); i++ {
+		enum[i] = string(vs.Get(i).Name())
+	}
+	return &openapi3.Schema{Type: openapi3.TypeString, Enum: enum}
+}
+
+func protobufFixedSchema(fd protoreflect.FieldDescriptor, wire string) *openapi3.Schema {
+	if fd == nil {
+		return &openapi3.Schema{Type: openapi3.TypeNumber, Format: wire}
+	}
+
+	switch fd.Kind() {
+	case protoreflect.FloatKind:
+		return &openapi3.Schema{Type: openapi3.TypeNumber, Format: "float"}
+	case protoreflect.DoubleKind:
+		return &openapi3.Schema{Type: openapi3.TypeNumber, Format: "double"}
+	case protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
+		return &openapi3.Schema{Type: openapi3.TypeInteger, Format: "int32"}
+	default:
+		return &openapi3.Schema{Type: openapi3.TypeInteger, Format: "int64"}
+	}
+}
+
+func protobufBytesSchema(v []byte, fd protoreflect.FieldDescriptor, depth int) (*openapi3.Schema, error) {
+	if fd == nil {
+		return guessProtobufBytesSchema(v, depth), nil
+	}
+
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return &openapi3.Schema{Type: openapi3.TypeString}, nil
+	case protoreflect.BytesKind:
+		return &openapi3.Schema{Type: openapi3.TypeString, Format: "byte"}, nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return parseProtobufMessage(v, fd.Message(), depth+1)
+	}
+
+	// anything else in a length-delimited field is a packed repeated scalar
+	var item *openapi3.Schema
+	switch fd.Kind() {
+	case protoreflect.FloatKind, protoreflect.DoubleKind,
+		protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+		item = protobufFixedSchema(fd, "")
+	default:
+		item = protobufVarintSchema(fd)
+	}
+	return &openapi3.Schema{Type: openapi3.TypeArray, Items: item.NewRef()}, nil
+}
+
+// guessProtobufBytesSchema decides what an undescribed length-delimited field is.
+// Readable text is a string, anything that decodes cleanly as a message is a message,
+// and whatever is left is just bytes.
+func guessProtobufBytesSchema(v []byte, depth int) *openapi3.Schema {
+	if isPrintable(v) {
+		return &openapi3.Schema{Type: openapi3.TypeString}
+	}
+	if s, err := parseProtobufMessage(v, nil, depth+1); err == nil && len(s.Properties) > 0 {
+		return s
+	}
+	return &openapi3.Schema{Type: openapi3.TypeString, Format: "byte"}
+}
+
+func isPrintable(v []byte) bool {
+	if !utf8.Valid(v) {
+		return false
+	}
+	for _, r := range string(v) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
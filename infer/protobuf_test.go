@@ -0,0 +1,100 @@
+package infer
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func sampleProtobuf() []byte {
+	var inner []byte
+	inner = protowire.AppendTag(inner, 1, protowire.VarintType)
+	inner = protowire.AppendVarint(inner, 7)
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, 150)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, "alice")
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, inner)
+	b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, 1)
+	b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, 2)
+	return b
+}
+
+func TestParseProtobufWithoutDescriptor(t *testing.T) {
+	s, err := ParseSampleProtobuf(sampleProtobuf(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, openapi3.TypeObject, s.Type)
+	assert.Equal(t, openapi3.TypeInteger, s.Properties["1"].Value.Type)
+	assert.Equal(t, openapi3.TypeString, s.Properties["2"].Value.Type)
+	assert.Equal(t, openapi3.TypeObject, s.Properties["3"].Value.Type)
+	assert.Equal(t, openapi3.TypeInteger, s.Properties["3"].Value.Properties["1"].Value.Type)
+	assert.Equal(t, openapi3.TypeArray, s.Properties["4"].Value.Type)
+	assert.Equal(t, "fixed64", s.Properties["4"].Value.Items.Value.Format)
+}
+
+func TestParseProtobufWithDescriptor(t *testing.T) {
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("user.proto"),
+		Package: proto.String("example"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Inner"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("count"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				},
+			},
+			{
+				Name: proto.String("User"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_UINT64.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+					{Name: proto.String("name"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+					{Name: proto.String("inner"), Number: proto.Int32(3), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".example.Inner"), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+					{Name: proto.String("scores"), Number: proto.Int32(4), Type: descriptorpb.FieldDescriptorProto_TYPE_DOUBLE.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()},
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(fdp, nil)
+	assert.Nil(t, err)
+	md := fd.Messages().ByName("User")
+
+	s, err := ParseSampleProtobuf(sampleProtobuf(), md)
+	assert.Nil(t, err)
+	assert.Equal(t, "int64", s.Properties["id"].Value.Format)
+	assert.Equal(t, openapi3.TypeString, s.Properties["name"].Value.Type)
+	assert.Equal(t, "int32", s.Properties["inner"].Value.Properties["count"].Value.Format)
+	assert.Equal(t, openapi3.TypeArray, s.Properties["scores"].Value.Type)
+	assert.Equal(t, "double", s.Properties["scores"].Value.Items.Value.Format)
+}
+
+func TestParseProtobufPacked(t *testing.T) {
+	var packed []byte
+	packed = protowire.AppendVarint(packed, 1)
+	packed = protowire.AppendVarint(packed, 2)
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, packed)
+
+	// without a descriptor this can only be guessed at, but it mustn't fail
+	s, err := ParseSampleProtobuf(b, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Properties["1"])
+}
+
+func TestParseProtobufTruncated(t *testing.T) {
+	b := sampleProtobuf()
+	_, err := ParseSampleProtobuf(b[:len(b)-3], nil)
+	assert.NotNil(t, err)
+}
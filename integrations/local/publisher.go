@@ -0,0 +1,179 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/google/uuid"
+	"github.com/siegeai/siegelistener/integrations/siegeserver"
+	"github.com/siegeai/siegelistener/merge"
+)
+
+const (
+	DocFileName        = "openapi.json"
+	MetricsFileName    = "metrics.txt"
+	ViolationsFileName = "violations.json"
+	DriftFileName      = "drift.json"
+)
+
+// maxViolations and maxDrift are how many of the latest violations and drift events
+// are kept on disk.
+const (
+	maxViolations = 1000
+	maxDrift      = 1000
+)
+
+// Publisher keeps everything on disk instead of sending it to the siege server. The
+// paths in each update become the OpenAPI document written to Dir alongside the latest
+// metrics. It never touches the network.
+type Publisher struct {
+	Dir string
+
+	mu         sync.Mutex
+	doc        *openapi3.T
+	metrics    string
+	violations []siegeserver.Violation
+	drift      []siegeserver.Drift
+}
+
+func NewPublisher(dir string) (*Publisher, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	p := &Publisher{
+		Dir: dir,
+		doc: &openapi3.T{
+			OpenAPI: "3.0.0",
+			Info:    &openapi3.Info{Title: "Siege Listener", Version: "0.0.1"},
+			Paths:   openapi3.Paths{},
+		},
+	}
+	return p, nil
+}
+
+func (p *Publisher) Startup(ctx context.Context) (*siegeserver.ListenerConfig, error) {
+	return &siegeserver.ListenerConfig{ListenerID: uuid.NewString()}, nil
+}
+
+func (p *Publisher) Shutdown(ctx context.Context, listenerID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.write()
+}
+
+func (p *Publisher) Update(ctx context.Context, args siegeserver.ListenerUpdate) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The listener sends the whole merged document whenever it changes, an update
+	// without schemas leaves the current document alone.
+	if len(args.Schemas) > 0 {
+		var m merge.Merger
+		paths := openapi3.Paths{}
+		for _, s := range args.Schemas {
+			var ps openapi3.Paths
+			if err := json.Unmarshal([]byte(s), &ps); err != nil {
+				return err
+			}
+			paths = m.Paths(paths, ps)
+		}
+		p.doc.Paths = paths
+	}
+	if args.Components != "" {
+		var c openapi3.Components
+		if err := json.Unmarshal([]byte(args.Components), &c); err != nil {
+			return err
+		}
+		p.doc.Components = &c
+	}
+	p.metrics = args.Metrics
+
+	p.violations = append(p.violations, args.Violations...)
+	if n := len(p.violations); n > maxViolations {
+		p.violations = p.violations[n-maxViolations:]
+	}
+
+	p.drift = append(p.drift, args.Drift...)
+	if n := len(p.drift); n > maxDrift {
+		p.drift = p.drift[n-maxDrift:]
+	}
+
+	return p.write()
+}
+
+// Doc returns a copy of the merged document so far, the publisher's own changes with
+// every update.
+func (p *Publisher) Doc() *openapi3.T {
+	p.mu.Lock()
+	bs, err := json.Marshal(p.doc)
+	p.mu.Unlock()
+	if err != nil {
+		panic(err)
+	}
+
+	var doc openapi3.T
+	if err := json.Unmarshal(bs, &doc); err != nil {
+		panic(err)
+	}
+	return &doc
+}
+
+func (p *Publisher) write() error {
+	bs, err := json.MarshalIndent(p.doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(p.Dir, DocFileName), bs); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(p.Dir, MetricsFileName), []byte(p.metrics)); err != nil {
+		return err
+	}
+	if len(p.violations) != 0 {
+		bs, err = json.MarshalIndent(p.violations, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(p.Dir, ViolationsFileName), bs); err != nil {
+			return err
+		}
+	}
+	if len(p.drift) != 0 {
+		bs, err = json.MarshalIndent(p.drift, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(p.Dir, DriftFileName), bs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic makes sure anything tailing the output directory never sees a half
+// written file.
+func writeFileAtomic(name string, bs []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(bs); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
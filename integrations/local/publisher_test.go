@@ -0,0 +1,70 @@
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/siegeai/siegelistener/integrations/siegeserver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateMergesAndWrites(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPublisher(dir)
+	assert.Nil(t, err)
+
+	update := siegeserver.ListenerUpdate{
+		Schemas: []string{
+			`{"/users":{"get":{"responses":{"200":{"description":""}}}}}`,
+			`{"/users":{"post":{"responses":{"201":{"description":""}}}}}`,
+		},
+		Metrics: "siege_listener_http_response_total 2\n",
+	}
+	assert.Nil(t, p.Update(context.Background(), update))
+
+	doc := p.Doc()
+	assert.NotNil(t, doc.Paths["/users"].Get)
+	assert.NotNil(t, doc.Paths["/users"].Post)
+
+	bs, err := os.ReadFile(filepath.Join(dir, DocFileName))
+	assert.Nil(t, err)
+	assert.Contains(t, string(bs), `"/users"`)
+
+	bs, err = os.ReadFile(filepath.Join(dir, MetricsFileName))
+	assert.Nil(t, err)
+	assert.Equal(t, update.Metrics, string(bs))
+}
+
+func TestUpdateWithoutSchemasKeepsDoc(t *testing.T) {
+	p, err := NewPublisher(t.TempDir())
+	assert.Nil(t, err)
+
+	first := siegeserver.ListenerUpdate{
+		Schemas: []string{`{"/users":{"get":{"responses":{"200":{"description":""}}}}}`},
+	}
+	assert.Nil(t, p.Update(context.Background(), first))
+	assert.Nil(t, p.Update(context.Background(), siegeserver.ListenerUpdate{Metrics: "m"}))
+
+	assert.NotNil(t, p.Doc().Paths["/users"].Get)
+}
+
+func TestDocIsACopy(t *testing.T) {
+	p, err := NewPublisher(t.TempDir())
+	assert.Nil(t, err)
+
+	update := siegeserver.ListenerUpdate{
+		Schemas: []string{`{"/users":{"get":{"responses":{"200":{"description":""}}}}}`},
+	}
+	assert.Nil(t, p.Update(context.Background(), update))
+
+	doc := p.Doc()
+	delete(doc.Paths, "/users")
+	assert.NotNil(t, p.Doc().Paths["/users"])
+
+	doc = p.Doc()
+	update.Schemas = []string{`{"/orders":{"get":{"responses":{"200":{"description":""}}}}}`}
+	assert.Nil(t, p.Update(context.Background(), update))
+	assert.NotContains(t, doc.Paths, "/orders")
+}
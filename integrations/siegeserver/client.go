@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type Client struct {
@@ -93,9 +94,37 @@ func (c *Client) Shutdown(ctx context.Context, listenerID string) error {
 }
 
 type ListenerUpdate struct {
-	ListenerID string   `json:"listenerID"`
-	Schemas    []string `json:"schemas"`
-	Metrics    string   `json:"metrics"`
+	ListenerID string      `json:"listenerID"`
+	Schemas    []string    `json:"schemas"`
+	Components string      `json:"components,omitempty"` // shared parts of the schemas
+	Metrics    string      `json:"metrics"`
+	Violations []Violation `json:"violations,omitempty"`
+	Drift      []Drift     `json:"drift,omitempty"`
+}
+
+// Violation is a sampled request or response that broke the contract in a reference
+// spec. Values from the traffic itself are never included.
+type Violation struct {
+	Time    time.Time `json:"time"`
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Status  int       `json:"status"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+}
+
+// Drift is a change in the shape of an operation's traffic, like a new field or a
+// field that changed type. Old and New are the schemas at Pointer before and after,
+// null when there wasn't one.
+type Drift struct {
+	Time     time.Time       `json:"time"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Pointer  string          `json:"pointer"`
+	Kind     string          `json:"kind"`
+	Breaking bool            `json:"breaking"`
+	Old      json.RawMessage `json:"old"`
+	New      json.RawMessage `json:"new"`
 }
 
 func (c *Client) Update(ctx context.Context, args ListenerUpdate) error {
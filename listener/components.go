@@ -0,0 +1,254 @@
+package listener
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/merge"
+	"github.com/siegeai/siegelistener/pathtemplate"
+)
+
+const (
+	// minComponentUses is how many places an object has to show up in before it's
+	// worth being a component.
+	minComponentUses = 2
+	// minComponentProperties keeps small objects like {"id": 1} inline, two of those
+	// being alike says very little.
+	minComponentProperties = 2
+	// componentSimilarity is the share of properties two objects need in common to be
+	// taken for the same type.
+	componentSimilarity = 0.75
+)
+
+// schemaUse is one place an object schema appears in the document.
+type schemaUse struct {
+	ref   *openapi3.SchemaRef
+	hint  string
+	props map[string]string
+}
+
+type schemaGroup struct {
+	uses []*schemaUse
+}
+
+// hoistSchemas moves objects that show up across the document into components.schemas
+// and points each place they were at the component instead. Objects are the same type
+// when they have the same or nearly the same properties, the component is their merge.
+func hoistSchemas(doc *openapi3.T) {
+	var uses []*schemaUse
+	for _, path := range sortedKeys(doc.Paths) {
+		item := doc.Paths[path]
+		hint := pathHint(path)
+		ops := item.Operations()
+		for _, method := range sortedKeys(ops) {
+			op := ops[method]
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				uses = collectContentSchemas(uses, op.RequestBody.Value.Content, hint)
+			}
+			for _, status := range sortedKeys(op.Responses) {
+				if r := op.Responses[status]; r.Value != nil {
+					uses = collectContentSchemas(uses, r.Value.Content, hint)
+				}
+			}
+		}
+	}
+
+	groups := groupSchemaUses(uses)
+	if len(groups) == 0 {
+		return
+	}
+	if doc.Components == nil {
+		doc.Components = &openapi3.Components{}
+	}
+	if doc.Components.Schemas == nil {
+		doc.Components.Schemas = openapi3.Schemas{}
+	}
+
+	// point every use at its component first, so components that contain each other
+	// are merged with the refs in place
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = componentName(doc.Components.Schemas, g)
+		doc.Components.Schemas[names[i]] = nil
+		for _, u := range g.uses {
+			u.ref.Ref = "#/components/schemas/" + names[i]
+		}
+	}
+	for i, g := range groups {
+		var m merge.Merger
+		var s *openapi3.Schema
+		for _, u := range g.uses {
+			s = m.Schema(s, u.ref.Value)
+		}
+		doc.Components.Schemas[names[i]] = s.NewRef()
+	}
+}
+
+func collectContentSchemas(uses []*schemaUse, content openapi3.Content, hint string) []*schemaUse {
+	for _, mt := range sortedKeys(content) {
+		uses = collectSchemas(uses, content[mt].Schema, hint)
+	}
+	return uses
+}
+
+// collectSchemas finds the objects in ref, innermost first.
+func collectSchemas(uses []*schemaUse, ref *openapi3.SchemaRef, hint string) []*schemaUse {
+	if ref == nil || ref.Ref != "" || ref.Value == nil {
+		return uses
+	}
+	s := ref.Value
+
+	for _, k := range sortedKeys(s.Properties) {
+		uses = collectSchemas(uses, s.Properties[k], k)
+	}
+	uses = collectSchemas(uses, s.Items, hint)
+	uses = collectSchemas(uses, s.AdditionalProperties.Schema, hint)
+	for _, rs := range []openapi3.SchemaRefs{s.OneOf, s.AnyOf, s.AllOf} {
+		for _, r := range rs {
+			uses = collectSchemas(uses, r, hint)
+		}
+	}
+
+	if s.Type != openapi3.TypeObject || len(s.Properties) < minComponentProperties {
+		return uses
+	}
+	props := make(map[string]string, len(s.Properties))
+	for k, p := range s.Properties {
+		t := ""
+		if p.Value != nil {
+			t = p.Value.Type
+		}
+		props[k] = t
+	}
+	return append(uses, &schemaUse{ref: ref, hint: hint, props: props})
+}
+
+// groupSchemaUses puts each use in the first group it's similar enough to, and keeps
+// the groups that are used often enough.
+func groupSchemaUses(uses []*schemaUse) []*schemaGroup {
+	var groups []*schemaGroup
+	for _, u := range uses {
+		var into *schemaGroup
+		for _, g := range groups {
+			if similarity(g.uses[0].props, u.props) >= componentSimilarity {
+				into = g
+				break
+			}
+		}
+		if into == nil {
+			into = &schemaGroup{}
+			groups = append(groups, into)
+		}
+		into.uses = append(into.uses, u)
+	}
+
+	res := groups[:0]
+	for _, g := range groups {
+		if len(g.uses) >= minComponentUses {
+			res = append(res, g)
+		}
+	}
+	return res
+}
+
+// similarity is the share of properties, by name and type, that a and b have in common.
+func similarity(a, b map[string]string) float64 {
+	common := 0
+	for k, t := range a {
+		if u, in := b[k]; in && u == t {
+			common++
+		}
+	}
+	all := len(a) + len(b) - common
+	if all == 0 {
+		return 1
+	}
+	return float64(common) / float64(all)
+}
+
+// componentName names a group after what its uses were most often called.
+func componentName(taken openapi3.Schemas, g *schemaGroup) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, u := range g.uses {
+		name := pathtemplate.TypeName(u.hint)
+		counts[name]++
+		if counts[name] > counts[best] {
+			best = name
+		}
+	}
+	if best == "" {
+		best = "Object"
+	}
+
+	name := best
+	for i := 2; ; i++ {
+		if _, in := taken[name]; !in {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", best, i)
+	}
+}
+
+// pathHint is the last part of a path that isn't a parameter, /users/{userId} holds
+// a user.
+func pathHint(path string) string {
+	parts := strings.Split(path, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if parts[i] != "" && !strings.HasPrefix(parts[i], "{") {
+			return parts[i]
+		}
+	}
+	return ""
+}
+
+// copyDoc deep copies a document so it can be rearranged for publishing. The copy
+// doesn't have the samples merge keeps to find enums.
+func copyDoc(doc *openapi3.T) (*openapi3.T, error) {
+	bs, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return nil, err
+	}
+	forgetSamples(v)
+	if bs, err = json.Marshal(v); err != nil {
+		return nil, err
+	}
+	var res openapi3.T
+	if err := json.Unmarshal(bs, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// forgetSamples removes the enum tracking extensions from a decoded document. They
+// hold values straight from the traffic, which never leave the host.
+func forgetSamples(v interface{}) {
+	switch w := v.(type) {
+	case map[string]interface{}:
+		delete(w, merge.EnumValuesExtension)
+		delete(w, merge.ObservationsExtension)
+		for _, u := range w {
+			forgetSamples(u)
+		}
+	case []interface{}:
+		for _, u := range w {
+			forgetSamples(u)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
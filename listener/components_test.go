@@ -0,0 +1,112 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/infer"
+	"github.com/siegeai/siegelistener/integrations/siegeserver"
+	"github.com/stretchr/testify/assert"
+)
+
+func jsonOperation(t *testing.T, body string) *openapi3.Operation {
+	s, err := infer.ParseSampleBodyBytes([]byte(body))
+	assert.Nil(t, err)
+	res := openapi3.NewResponse().WithJSONSchema(s)
+	return &openapi3.Operation{Responses: openapi3.Responses{"200": {Value: res}}}
+}
+
+func TestHoistSchemas(t *testing.T) {
+	doc := &openapi3.T{Paths: openapi3.Paths{
+		"/users/{userId}": newPathItem(http.MethodGet, jsonOperation(t,
+			`{"id": 1, "name": "a", "address": {"street": "x", "city": "y"}}`)),
+		"/users": newPathItem(http.MethodGet, jsonOperation(t,
+			`[{"id": 1, "name": "a", "email": "a@example.com", "address": {"street": "x", "city": "y"}}]`)),
+		"/orders/{orderId}": newPathItem(http.MethodGet, jsonOperation(t,
+			`{"total": 3.5, "shipping": {"street": "x", "city": "y"}}`)),
+	}}
+
+	hoistSchemas(doc)
+
+	assert.ElementsMatch(t, []string{"User", "Address"}, sortedKeys(doc.Components.Schemas))
+
+	user := doc.Paths["/users/{userId}"].Get.Responses["200"].Value.Content["application/json"].Schema
+	assert.Equal(t, "#/components/schemas/User", user.Ref)
+	items := doc.Paths["/users"].Get.Responses["200"].Value.Content["application/json"].Schema.Value.Items
+	assert.Equal(t, "#/components/schemas/User", items.Ref)
+	order := doc.Paths["/orders/{orderId}"].Get.Responses["200"].Value.Content["application/json"].Schema
+	assert.Equal(t, "", order.Ref)
+	assert.Equal(t, "#/components/schemas/Address", order.Value.Properties["shipping"].Ref)
+
+	// the component is the merge of every use, and refers to the other components
+	component := doc.Components.Schemas["User"].Value
+	assert.Contains(t, component.Properties, "email")
+	assert.NotContains(t, component.Required, "email")
+	assert.Equal(t, "#/components/schemas/Address", component.Properties["address"].Ref)
+
+	bs, err := json.Marshal(doc.Paths)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(bs), "street")
+}
+
+func TestHoistSchemasKeepsOneOffsInline(t *testing.T) {
+	doc := &openapi3.T{Paths: openapi3.Paths{
+		"/a": newPathItem(http.MethodGet, jsonOperation(t, `{"x": 1, "y": 2}`)),
+		"/b": newPathItem(http.MethodGet, jsonOperation(t, `{"p": "a", "q": "b"}`)),
+	}}
+
+	hoistSchemas(doc)
+	assert.Nil(t, doc.Components)
+}
+
+type capturePublisher struct {
+	updates []siegeserver.ListenerUpdate
+	err     error // returned from Update, which keeps nothing then
+}
+
+func (p *capturePublisher) Startup(ctx context.Context) (*siegeserver.ListenerConfig, error) {
+	return &siegeserver.ListenerConfig{}, nil
+}
+
+func (p *capturePublisher) Shutdown(ctx context.Context, listenerID string) error {
+	return nil
+}
+
+func (p *capturePublisher) Update(ctx context.Context, args siegeserver.ListenerUpdate) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.updates = append(p.updates, args)
+	return nil
+}
+
+func TestPublishForgetsSamples(t *testing.T) {
+	p := &capturePublisher{}
+	l, err := NewListener(nil, p)
+	assert.Nil(t, err)
+
+	for _, body := range []string{
+		`{"name": "Alice", "total": 4111111111111111, "status": "active"}`,
+		`{"name": 7, "total": 4111111111111111, "status": "active"}`,
+	} {
+		ps := openapi3.Paths{"/orders": newPathItem(http.MethodGet, jsonOperation(t, body))}
+		bs, err := json.Marshal(ps)
+		assert.Nil(t, err)
+		l.handleRequestLog(&RequestLog{Path: "/orders", Method: http.MethodGet, Status: 200, Paths: ps, Schema: bs, Exact: true})
+	}
+	l.publish()
+
+	assert.Len(t, p.updates, 1)
+	bs, err := json.Marshal(p.updates[0])
+	assert.Nil(t, err)
+	assert.NotEmpty(t, p.updates[0].Drift)
+	for _, v := range []string{"Alice", "4111111111111111", "active", "x-siege-enum-values"} {
+		assert.NotContains(t, string(bs), v)
+	}
+
+	// the listener itself still has them, they're how it finds enums
+	assert.Contains(t, l.doc.Paths["/orders"].Get.Responses["200"].Value.Content["application/json"].Schema.Value.Properties["status"].Value.Extensions, "x-siege-enum-values")
+}
@@ -0,0 +1,64 @@
+package listener
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/infer"
+)
+
+const (
+	formContentType      = "application/x-www-form-urlencoded"
+	multipartContentType = "multipart/form-data"
+)
+
+// isInferable reports whether we know how to infer a schema for bodies of contentType.
+func isInferable(contentType string) bool {
+	mt := infer.MediaTypeKey(contentType)
+	return strings.Contains(mt, "json") ||
+		mt == formContentType ||
+		mt == multipartContentType ||
+		isXML(mt)
+}
+
+func isXML(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// inferMediaType infers the schema of a body by its Content-Type. The content is keyed
+// by the bare media type, parameters like the multipart boundary change every request.
+// Bodies of a type we don't understand still get a media type, just without a schema.
+func inferMediaType(contentType string, body []byte) (string, *openapi3.MediaType, error) {
+	key := infer.MediaTypeKey(contentType)
+	mt := openapi3.NewMediaType()
+
+	var sch *openapi3.Schema
+	var err error
+	switch {
+	case strings.Contains(key, "json"):
+		sch, err = infer.ParseSampleBodyBytes(body)
+	case key == formContentType:
+		sch, err = infer.ParseSampleFormBytes(body)
+	case key == multipartContentType:
+		_, params, perr := mime.ParseMediaType(contentType)
+		if perr != nil {
+			return key, nil, perr
+		}
+		var enc map[string]*openapi3.Encoding
+		sch, enc, err = infer.ParseSampleMultipartBytes(body, params["boundary"])
+		if len(enc) > 0 {
+			mt.Encoding = enc
+		}
+	case isXML(key):
+		sch, err = infer.ParseSampleXMLBytes(body)
+	default:
+		return key, mt, nil
+	}
+	if err != nil {
+		return key, nil, err
+	}
+
+	mt.Schema = sch.NewRef()
+	return key, mt, nil
+}
@@ -0,0 +1,181 @@
+package listener
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/siegeai/siegelistener/diff"
+	"github.com/siegeai/siegelistener/integrations/siegeserver"
+)
+
+// maxDriftSamples is how many drift events of each kind we keep per operation between
+// publishes, the metric counts all of them.
+const maxDriftSamples = 5
+
+// drift counts changes in the shape of traffic to operations we already know and keeps
+// a sample of them. Unlike violations it's only touched from the publish job.
+type drift struct {
+	total *prometheus.CounterVec
+
+	counts  map[string]int
+	samples []siegeserver.Drift
+}
+
+func newDrift() *drift {
+	return &drift{
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "siege",
+			Subsystem: "listener",
+			Name:      "schema_drift_total",
+		}, []string{"path", "method", "kind"}),
+		counts: make(map[string]int),
+	}
+}
+
+func (d *drift) record(method, path string, c diff.Change, before, after json.RawMessage) {
+	d.total.WithLabelValues(path, method, c.Kind).Inc()
+
+	key := method + " " + path + " " + c.Kind
+	if d.counts[key] >= maxDriftSamples {
+		return
+	}
+	d.counts[key]++
+	d.samples = append(d.samples, siegeserver.Drift{
+		Time:     time.Now(),
+		Method:   method,
+		Path:     path,
+		Pointer:  c.Path,
+		Kind:     c.Kind,
+		Breaking: c.Breaking,
+		Old:      before,
+		New:      after,
+	})
+}
+
+// pending returns the samples that haven't been published yet.
+func (d *drift) pending() []siegeserver.Drift {
+	return append([]siegeserver.Drift(nil), d.samples...)
+}
+
+// published forgets the first n samples, once they've made it to the publisher.
+func (d *drift) published(n int) {
+	d.samples = d.samples[n:]
+	if len(d.samples) == 0 {
+		d.samples = nil
+	}
+	d.counts = make(map[string]int)
+}
+
+// drain hands over the samples kept since the last call.
+func (d *drift) drain() []siegeserver.Drift {
+	res := d.pending()
+	d.published(len(res))
+	return res
+}
+
+// detectDrift compares each operation in sample as it was in before and is in after,
+// once the sample has been merged in. Operations seen for the first time aren't drift,
+// there's nothing for them to drift from.
+func (l *Listener) detectDrift(before, after, sample openapi3.Paths) {
+	for _, path := range sortedKeys(sample) {
+		a, b := before[path], after[path]
+		if a == nil || b == nil {
+			continue
+		}
+		for _, method := range sortedKeys(sample[path].Operations()) {
+			opA, opB := a.GetOperation(method), b.GetOperation(method)
+			if opA == nil || opB == nil {
+				continue
+			}
+
+			pa := openapi3.Paths{path: newPathItem(method, opA)}
+			pb := openapi3.Paths{path: newPathItem(method, opB)}
+			for _, c := range diff.Docs(&openapi3.T{Paths: pa}, &openapi3.T{Paths: pb}) {
+				// enums come and go as values are observed, a format is dropped by the first
+				// sample that doesn't fit it and an integer becomes a number once a fraction
+				// shows up, that's us learning, not the api changing
+				if c.Kind == diff.ChangeEnum || c.Kind == diff.ChangeFormat {
+					continue
+				}
+
+				var oldShape, newShape json.RawMessage
+				if c.Kind != diff.ChangeAdded {
+					oldShape = shapeAt(pa, c.Path)
+				}
+				if c.Kind != diff.ChangeRemoved {
+					newShape = shapeAt(pb, c.Path)
+				}
+				if c.Kind == diff.ChangeType && widenedToNumber(oldShape, newShape) {
+					continue
+				}
+
+				l.Log.Info("schema drift", "method", method, "path", path, "pointer", c.Path, "kind", c.Kind, "breaking", c.Breaking)
+				l.drift.record(method, path, c, oldShape, newShape)
+			}
+		}
+	}
+}
+
+// widenedToNumber reports whether a type change is an integer that's now a number.
+func widenedToNumber(before, after json.RawMessage) bool {
+	var a, b struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(before, &a) != nil || json.Unmarshal(after, &b) != nil {
+		return false
+	}
+	return a.Type == openapi3.TypeInteger && b.Type == openapi3.TypeNumber
+}
+
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// shapeAt returns what's at pointer in paths. Type, format and enum changes are shown
+// with the whole schema they're part of.
+func shapeAt(paths openapi3.Paths, pointer string) json.RawMessage {
+	bs, err := json.Marshal(openapi3.T{Paths: paths})
+	if err != nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return nil
+	}
+	forgetSamples(v)
+
+	tokens := strings.Split(pointer, "/")[1:]
+	if n := len(tokens); n > 0 {
+		switch tokens[n-1] {
+		case "type", "format", "enum":
+			tokens = tokens[:n-1]
+		}
+	}
+
+	for _, t := range tokens {
+		t = pointerUnescaper.Replace(t)
+		switch w := v.(type) {
+		case map[string]interface{}:
+			v = w[t]
+		case []interface{}:
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 || i >= len(w) {
+				return nil
+			}
+			v = w[i]
+		default:
+			return nil
+		}
+	}
+	if v == nil {
+		return nil
+	}
+
+	res, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return res
+}
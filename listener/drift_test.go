@@ -0,0 +1,80 @@
+package listener
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/diff"
+	"github.com/siegeai/siegelistener/merge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectDrift(t *testing.T) {
+	l, err := NewListener(nil, nil)
+	assert.Nil(t, err)
+
+	sample := func(op *openapi3.Operation) {
+		ps := openapi3.Paths{"/users": newPathItem(http.MethodGet, op)}
+		before := l.doc
+		l.doc = new(merge.Merger).Doc(l.doc, &openapi3.T{Paths: ps})
+		l.detectDrift(before.Paths, l.doc.Paths, ps)
+	}
+
+	// the first sight of an operation isn't drift
+	sample(jsonOperation(t, `{"id": 1, "name": "a"}`))
+	assert.Empty(t, l.drift.samples)
+
+	sample(jsonOperation(t, `{"id": "u1", "email": "a@example.com"}`))
+	notFound := &openapi3.Operation{Responses: openapi3.Responses{"404": {Value: openapi3.NewResponse()}}}
+	sample(notFound)
+
+	drift := l.drift.drain()
+	kinds := map[string]string{}
+	for _, d := range drift {
+		kinds[d.Pointer] = d.Kind
+	}
+	props := "/paths/~1users/get/responses/200/content/application~1json/schema/properties"
+	assert.Equal(t, map[string]string{
+		props + "/email":                   diff.ChangeAdded,
+		props + "/id/type":                 diff.ChangeType,
+		props + "/name":                    diff.ChangeOptional,
+		"/paths/~1users/get/responses/404": diff.ChangeAdded,
+	}, kinds)
+
+	for _, d := range drift {
+		if d.Pointer == props+"/id/type" {
+			var before, after map[string]interface{}
+			assert.Nil(t, json.Unmarshal(d.Old, &before))
+			assert.Nil(t, json.Unmarshal(d.New, &after))
+			assert.Equal(t, "integer", before["type"])
+			assert.Len(t, after["oneOf"], 2)
+		}
+		if d.Kind == diff.ChangeAdded {
+			assert.Nil(t, d.Old)
+			assert.NotNil(t, d.New)
+		}
+	}
+	assert.Empty(t, l.drift.samples)
+}
+
+func TestDriftIgnoresLearning(t *testing.T) {
+	l, err := NewListener(nil, nil)
+	assert.Nil(t, err)
+
+	for _, body := range []string{
+		`{"at": "2023-10-01", "total": 3, "status": "active"}`,
+		`{"at": "soon", "total": 3.5, "status": "closed"}`,
+	} {
+		ps := openapi3.Paths{"/orders": newPathItem(http.MethodGet, jsonOperation(t, body))}
+		before := l.doc
+		l.doc = new(merge.Merger).Doc(l.doc, &openapi3.T{Paths: ps})
+		l.detectDrift(before.Paths, l.doc.Paths, ps)
+	}
+
+	props := l.doc.Paths["/orders"].Get.Responses["200"].Value.Content["application/json"].Schema.Value.Properties
+	assert.Equal(t, "", props["at"].Value.Format)
+	assert.Equal(t, openapi3.TypeNumber, props["total"].Value.Type)
+	assert.Empty(t, l.drift.drain())
+}
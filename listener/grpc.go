@@ -0,0 +1,190 @@
+package listener
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/infer"
+	"github.com/siegeai/siegelistener/merge"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var ErrGrpcFrame = errors.New("malformed grpc message frame")
+
+const grpcContentType = "application/grpc"
+
+// LoadDescriptorSet reads a FileDescriptorSet, as written by
+// `protoc --include_imports --descriptor_set_out`, so gRPC fields can be named.
+func LoadDescriptorSet(fileName string) (*protoregistry.Files, error) {
+	bs, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(bs, &set); err != nil {
+		return nil, err
+	}
+
+	return protodesc.NewFiles(&set)
+}
+
+func isGrpc(contentType string) bool {
+	return strings.HasPrefix(contentType, grpcContentType)
+}
+
+// handleGrpc records a gRPC call as a POST to /package.Service/Method, with the
+// request and response messages as the bodies.
+func (l *Listener) handleGrpc(r *http.Request, w *http.Response, payload float64, duration float64) error {
+	in, out := l.grpcMethodDescriptors(r.URL.Path)
+
+	reqSchema, err := parseGrpcBody(r.Body, r.Header.Get("Grpc-Encoding"), in)
+	if err != nil {
+		return err
+	}
+
+	resSchema, err := parseGrpcBody(w.Body, w.Header.Get("Grpc-Encoding"), out)
+	if err != nil {
+		return err
+	}
+
+	op := openapi3.Operation{}
+	if service, _, ok := splitGrpcPath(r.URL.Path); ok {
+		op.Tags = []string{service}
+	}
+
+	if reqSchema != nil {
+		mt := openapi3.NewMediaType()
+		mt.Schema = reqSchema.NewRef()
+		rb := openapi3.NewRequestBody()
+		rb.Content = openapi3.Content{grpcContentType: mt}
+		op.RequestBody = &openapi3.RequestBodyRef{Value: rb}
+	}
+
+	rs := openapi3.NewResponse().WithDescription("")
+	if resSchema != nil {
+		mt := openapi3.NewMediaType()
+		mt.Schema = resSchema.NewRef()
+		rs.Content = openapi3.Content{grpcContentType: mt}
+	}
+	// gRPC nearly always answers 200, the real outcome is in the trailers
+	op.Responses = openapi3.Responses{strconv.Itoa(w.StatusCode): &openapi3.ResponseRef{Value: rs}}
+
+	pathItem := newPathItem(http.MethodPost, &op)
+	l.enqueueRequestLog(r.URL.Path, http.MethodPost, w.StatusCode, pathItem, payload, duration, true)
+	return nil
+}
+
+// grpcMethodDescriptors finds the message types for the method at path, if a
+// descriptor set was loaded and knows about it.
+func (l *Listener) grpcMethodDescriptors(path string) (protoreflect.MessageDescriptor, protoreflect.MessageDescriptor) {
+	if l.Descriptors == nil {
+		return nil, nil
+	}
+
+	service, method, ok := splitGrpcPath(path)
+	if !ok {
+		return nil, nil
+	}
+
+	d, err := l.Descriptors.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, nil
+	}
+
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, nil
+	}
+
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, nil
+	}
+
+	return md.Input(), md.Output()
+}
+
+func splitGrpcPath(path string) (string, string, bool) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !ok || service == "" || method == "" {
+		return "", "", false
+	}
+	return service, method, true
+}
+
+// parseGrpcBody infers a schema from every length-prefixed message in a body. A
+// streaming call can have many messages, they are merged into one schema.
+func parseGrpcBody(body io.Reader, encoding string, md protoreflect.MessageDescriptor) (*openapi3.Schema, error) {
+	bs, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := splitGrpcMessages(bs, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	var m merge.Merger
+	var res *openapi3.Schema
+	for _, msg := range msgs {
+		s, err := infer.ParseSampleProtobuf(msg, md)
+		if err != nil {
+			return nil, err
+		}
+		res = m.Schema(res, s)
+	}
+
+	return res, nil
+}
+
+// splitGrpcMessages undoes the gRPC framing, each message is a compressed flag and a
+// big-endian length followed by that many bytes.
+func splitGrpcMessages(bs []byte, encoding string) ([][]byte, error) {
+	if encoding == "identity" {
+		encoding = ""
+	}
+
+	var msgs [][]byte
+	for len(bs) > 0 {
+		if len(bs) < 5 {
+			return nil, ErrGrpcFrame
+		}
+		flags := bs[0]
+		n := binary.BigEndian.Uint32(bs[1:5])
+		if uint64(len(bs)-5) < uint64(n) {
+			return nil, ErrGrpcFrame
+		}
+		msg := bs[5 : 5+n]
+		bs = bs[5+n:]
+
+		if flags&0x80 != 0 {
+			// grpc-web puts the trailers in a frame of their own
+			continue
+		}
+
+		if flags&0x01 != 0 {
+			d, err := readAllEncoded(encoding, io.NopCloser(bytes.NewReader(msg)))
+			if err != nil {
+				return nil, err
+			}
+			msg = d
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
@@ -0,0 +1,114 @@
+package listener
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func grpcFrame(flags byte, msg []byte) []byte {
+	bs := make([]byte, 5, 5+len(msg))
+	bs[0] = flags
+	binary.BigEndian.PutUint32(bs[1:5], uint32(len(msg)))
+	return append(bs, msg...)
+}
+
+func gzipped(t *testing.T, bs []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(bs)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func concat(frames ...[]byte) []byte {
+	return bytes.Join(frames, nil)
+}
+
+func TestSplitGrpcMessages(t *testing.T) {
+	a := []byte{0x08, 0x96, 0x01} // field 1, varint 150
+	b := []byte{0x12, 0x02, 'h', 'i'}
+
+	cases := []struct {
+		name     string
+		body     []byte
+		encoding string
+		want     [][]byte
+		err      error
+	}{
+		{name: "empty", body: nil},
+		{name: "one", body: grpcFrame(0, a), want: [][]byte{a}},
+		{name: "several", body: concat(grpcFrame(0, a), grpcFrame(0, b), grpcFrame(0, nil)), want: [][]byte{a, b, {}}},
+		{name: "truncated prefix", body: concat(grpcFrame(0, a), []byte{0, 0, 0}), err: ErrGrpcFrame},
+		{name: "truncated payload", body: grpcFrame(0, a)[:6], err: ErrGrpcFrame},
+		{name: "length past the end", body: concat([]byte{0, 0xff, 0xff, 0xff, 0xff}, a), err: ErrGrpcFrame},
+		{name: "compressed", body: grpcFrame(1, gzipped(t, a)), encoding: "gzip", want: [][]byte{a}},
+		{name: "compressed and not", body: concat(grpcFrame(1, gzipped(t, a)), grpcFrame(0, b)), encoding: "gzip", want: [][]byte{a, b}},
+		{name: "identity", body: grpcFrame(0, a), encoding: "identity", want: [][]byte{a}},
+		{name: "grpc-web trailers", body: concat(grpcFrame(0, a), grpcFrame(0x80, []byte("grpc-status:0\r\n"))), want: [][]byte{a}},
+	}
+	for _, c := range cases {
+		msgs, err := splitGrpcMessages(c.body, c.encoding)
+		assert.Equal(t, c.err, err, c.name)
+		assert.Equal(t, c.want, msgs, c.name)
+	}
+}
+
+func TestHandleGrpc(t *testing.T) {
+	a := []byte{0x08, 0x96, 0x01}                 // field 1, varint 150
+	b := []byte{0x08, 0x01, 0x12, 0x02, 'h', 'i'} // field 1 and field 2, "hi"
+
+	cases := []struct {
+		name     string
+		req      []byte
+		encoding string
+		props    []string
+		err      error
+	}{
+		{name: "one", req: grpcFrame(0, a), props: []string{"1"}},
+		{name: "stream", req: concat(grpcFrame(0, a), grpcFrame(0, b)), props: []string{"1", "2"}},
+		{name: "compressed", req: grpcFrame(1, gzipped(t, b)), encoding: "gzip", props: []string{"1", "2"}},
+		{name: "truncated prefix", req: []byte{0, 0}, err: ErrGrpcFrame},
+		{name: "truncated payload", req: grpcFrame(0, b)[:8], err: ErrGrpcFrame},
+	}
+	for _, c := range cases {
+		l, err := NewListener(nil, nil)
+		assert.Nil(t, err)
+
+		r, err := http.NewRequest(http.MethodPost, "http://x/users.v1.Users/Get", bytes.NewReader(c.req))
+		assert.Nil(t, err)
+		r.Header.Set("Content-Type", grpcContentType)
+		if c.encoding != "" {
+			r.Header.Set("Grpc-Encoding", c.encoding)
+		}
+		w := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(grpcFrame(0, a)))}
+
+		errs := make(chan error, 1)
+		go func() { errs <- l.handleGrpc(r, w, 0, 0) }()
+		if c.err != nil {
+			assert.Equal(t, c.err, <-errs, c.name)
+			continue
+		}
+		log := <-l.requestLogs
+		assert.Nil(t, <-errs, c.name)
+
+		assert.True(t, log.Exact, c.name)
+		assert.Equal(t, "/users.v1.Users/Get", log.Path, c.name)
+		op := log.Paths[log.Path].Post
+		assert.Equal(t, []string{"users.v1.Users"}, op.Tags, c.name)
+
+		s := op.RequestBody.Value.Content[grpcContentType].Schema.Value
+		var props []string
+		for k := range s.Properties {
+			props = append(props, k)
+		}
+		assert.ElementsMatch(t, c.props, props, c.name)
+		assert.NotNil(t, op.Responses["200"].Value.Content[grpcContentType], c.name)
+	}
+}
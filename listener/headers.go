@@ -0,0 +1,270 @@
+package listener
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/infer"
+	"github.com/siegeai/siegelistener/merge"
+)
+
+const (
+	// commonHeaderOps is how many operations a header has to show up on before it
+	// is considered part of the API as a whole rather than any one endpoint.
+	commonHeaderOps = 3
+	// maxHeaderParameters bounds how many headers or cookies we record from a single
+	// message, some clients send a lot of junk.
+	maxHeaderParameters = 32
+)
+
+// deniedHeaders are hop-by-hop headers and those added by proxies, load balancers and
+// tracing, none of which say anything about the API. Content-Type, Accept and
+// Authorization are described elsewhere in a document so they're left out too.
+var deniedHeaders = map[string]bool{
+	"Accept":                    true,
+	"Accept-Encoding":           true,
+	"Age":                       true,
+	"Alt-Svc":                   true,
+	"Authorization":             true,
+	"B3":                        true,
+	"Cache-Control":             true,
+	"Connection":                true,
+	"Content-Encoding":          true,
+	"Content-Length":            true,
+	"Content-Type":              true,
+	"Cookie":                    true,
+	"Date":                      true,
+	"Expires":                   true,
+	"Forwarded":                 true,
+	"Host":                      true,
+	"Http2-Settings":            true,
+	"Keep-Alive":                true,
+	"Pragma":                    true,
+	"Proxy-Authenticate":        true,
+	"Proxy-Authorization":       true,
+	"Proxy-Connection":          true,
+	"Server":                    true,
+	"Set-Cookie":                true,
+	"Strict-Transport-Security": true,
+	"Te":                        true,
+	"Traceparent":               true,
+	"Tracestate":                true,
+	"Trailer":                   true,
+	"Transfer-Encoding":         true,
+	"Upgrade":                   true,
+	"User-Agent":                true,
+	"Vary":                      true,
+	"Via":                       true,
+	"X-Amzn-Trace-Id":           true,
+	"X-Cloud-Trace-Context":     true,
+	"X-Real-Ip":                 true,
+	"X-Request-Id":              true,
+}
+
+var deniedHeaderPrefixes = []string{
+	"Cf-",
+	"X-Amz-Cf-",
+	"X-B3-",
+	"X-Envoy-",
+	"X-Forwarded-",
+}
+
+func isDeniedHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	if deniedHeaders[name] {
+		return true
+	}
+	for _, p := range deniedHeaderPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerParameters records the headers and cookies of a request as parameters.
+func headerParameters(r *http.Request) openapi3.Parameters {
+	var ps openapi3.Parameters
+	for _, name := range allowedHeaderNames(r.Header) {
+		ps = append(ps, &openapi3.ParameterRef{Value: &openapi3.Parameter{
+			Name:     name,
+			In:       openapi3.ParameterInHeader,
+			Required: true,
+			Schema:   infer.ParseSampleHeaderValue(r.Header.Get(name)).NewRef(),
+		}})
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range r.Cookies() {
+		if seen[c.Name] || len(seen) == maxHeaderParameters {
+			continue
+		}
+		seen[c.Name] = true
+		// cookies are mostly session ids and the like, the name is all we keep
+		ps = append(ps, &openapi3.ParameterRef{Value: &openapi3.Parameter{
+			Name:     c.Name,
+			In:       openapi3.ParameterInCookie,
+			Required: true,
+			Schema:   openapi3.NewStringSchema().NewRef(),
+		}})
+	}
+
+	return ps
+}
+
+// responseHeaders records the headers of a response.
+func responseHeaders(w *http.Response) openapi3.Headers {
+	names := allowedHeaderNames(w.Header)
+	if len(names) == 0 {
+		return nil
+	}
+
+	hs := make(openapi3.Headers, len(names))
+	for _, name := range names {
+		hs[name] = &openapi3.HeaderRef{Value: &openapi3.Header{Parameter: openapi3.Parameter{
+			Schema: infer.ParseSampleHeaderValue(w.Header.Get(name)).NewRef(),
+		}}}
+	}
+	return hs
+}
+
+func allowedHeaderNames(h http.Header) []string {
+	var names []string
+	for k := range h {
+		if !isDeniedHeader(k) {
+			names = append(names, http.CanonicalHeaderKey(k))
+		}
+	}
+	sort.Strings(names)
+	if len(names) > maxHeaderParameters {
+		names = names[:maxHeaderParameters]
+	}
+	return names
+}
+
+// headerProfile keeps track of which operations each header shows up on. Headers sent
+// to most of an API, like a tenant id or a rate limit, are stored once in the
+// document's components and referenced from each operation instead of being repeated.
+type headerProfile struct {
+	seen   map[string]map[string]struct{}
+	common map[string]bool
+}
+
+func newHeaderProfile() *headerProfile {
+	return &headerProfile{
+		seen:   make(map[string]map[string]struct{}),
+		common: make(map[string]bool),
+	}
+}
+
+// observe records that the header with key was sent to op, it reports true the first
+// time the header is seen on enough operations to count as common.
+func (p *headerProfile) observe(key, op string) bool {
+	if p.common[key] {
+		return false
+	}
+
+	ops, in := p.seen[key]
+	if !in {
+		ops = make(map[string]struct{})
+		p.seen[key] = ops
+	}
+	ops[op] = struct{}{}
+
+	if len(ops) < commonHeaderOps {
+		return false
+	}
+	delete(p.seen, key)
+	p.common[key] = true
+	return true
+}
+
+func parameterComponentKey(p *openapi3.Parameter) string {
+	return p.In + "." + p.Name
+}
+
+func responseHeaderComponentKey(name string) string {
+	return "response." + name
+}
+
+// profileHeaders moves common headers in ps into the document's components, swapping
+// them for references. A header that has only now become common is also swapped out
+// of everything merged into the document so far.
+func (l *Listener) profileHeaders(ps openapi3.Paths) {
+	var promoted []string
+	for path, item := range ps {
+		for method, op := range item.Operations() {
+			opKey := method + " " + path
+			for _, p := range op.Parameters {
+				if p.Value == nil || (p.Value.In != openapi3.ParameterInHeader && p.Value.In != openapi3.ParameterInCookie) {
+					continue
+				}
+				key := parameterComponentKey(p.Value)
+				if l.headers.observe(key, opKey) {
+					promoted = append(promoted, key)
+				}
+			}
+			for _, rs := range op.Responses {
+				if rs.Value == nil {
+					continue
+				}
+				for name := range rs.Value.Headers {
+					key := responseHeaderComponentKey(name)
+					if l.headers.observe(key, opKey) {
+						promoted = append(promoted, key)
+					}
+				}
+			}
+		}
+	}
+
+	if len(promoted) > 0 {
+		l.referenceCommonHeaders(l.doc.Paths)
+	}
+	l.referenceCommonHeaders(ps)
+}
+
+func (l *Listener) referenceCommonHeaders(ps openapi3.Paths) {
+	if l.doc.Components == nil {
+		l.doc.Components = &openapi3.Components{}
+	}
+	c := l.doc.Components
+
+	for _, item := range ps {
+		for _, op := range item.Operations() {
+			for i, p := range op.Parameters {
+				if p.Value == nil || !l.headers.common[parameterComponentKey(p.Value)] {
+					continue
+				}
+				key := parameterComponentKey(p.Value)
+				if c.Parameters == nil {
+					c.Parameters = openapi3.ParametersMap{}
+				}
+				// whether it's required depends on the endpoint, which a shared component can't say
+				v := *p.Value
+				v.Required = false
+				c.Parameters[key] = new(merge.Merger).ParameterRef(c.Parameters[key], &openapi3.ParameterRef{Value: &v})
+				op.Parameters[i] = &openapi3.ParameterRef{Ref: "#/components/parameters/" + key}
+			}
+
+			for _, rs := range op.Responses {
+				if rs.Value == nil {
+					continue
+				}
+				for name, h := range rs.Value.Headers {
+					key := responseHeaderComponentKey(name)
+					if h.Value == nil || !l.headers.common[key] {
+						continue
+					}
+					if c.Headers == nil {
+						c.Headers = openapi3.Headers{}
+					}
+					c.Headers[key] = new(merge.Merger).HeaderRef(c.Headers[key], h)
+					rs.Value.Headers[name] = &openapi3.HeaderRef{Ref: "#/components/headers/" + key}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package listener
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/merge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderParametersSkipsDenied(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant-Id", "42")
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+	r.Header.Set("Connection", "keep-alive")
+	r.Header.Set("Cookie", "session=abc; theme=dark")
+
+	ps := headerParameters(r)
+	names := map[string]string{}
+	for _, p := range ps {
+		names[p.Value.Name] = p.Value.In
+	}
+	assert.Equal(t, map[string]string{
+		"X-Tenant-Id": openapi3.ParameterInHeader,
+		"session":     openapi3.ParameterInCookie,
+		"theme":       openapi3.ParameterInCookie,
+	}, names)
+}
+
+func TestProfileHeadersPromotesCommon(t *testing.T) {
+	l := &Listener{doc: &openapi3.T{Paths: openapi3.Paths{}}, headers: newHeaderProfile()}
+
+	fragment := func(path string) openapi3.Paths {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("X-Tenant-Id", "42")
+		op := &openapi3.Operation{Parameters: headerParameters(r)}
+		return openapi3.Paths{path: newPathItem(http.MethodGet, op)}
+	}
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		ps := fragment(path)
+		l.profileHeaders(ps)
+		l.doc = new(merge.Merger).Doc(l.doc, &openapi3.T{Paths: ps})
+	}
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		p := l.doc.Paths[path].Get.Parameters[0]
+		assert.Equal(t, "#/components/parameters/header.X-Tenant-Id", p.Ref, path)
+	}
+	c := l.doc.Components.Parameters["header.X-Tenant-Id"]
+	assert.Equal(t, "X-Tenant-Id", c.Value.Name)
+	assert.False(t, c.Value.Required)
+}
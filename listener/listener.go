@@ -6,38 +6,51 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/json"
-	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/expfmt"
 	"github.com/siegeai/siegelistener/httpassembly"
-	"github.com/siegeai/siegelistener/infer"
 	"github.com/siegeai/siegelistener/integrations/siegeserver"
+	"github.com/siegeai/siegelistener/merge"
+	"github.com/siegeai/siegelistener/pathtemplate"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 type Listener struct {
 	ListenerID      string
 	publishInterval time.Duration
 	requestLogs     chan *RequestLog
-	schemasToSend   []string
+	done            chan struct{}
+	doc             *openapi3.T
+	docChanged      bool
 	schemasSeen     map[[md5.Size]byte]struct{}
 	responseMetrics map[ResponseMetricsKey]*ResponseMetrics
 	registry        *prometheus.Registry
 	source          PacketSource
 	Assembler       *httpassembly.HttpAssembler
-	Client          *siegeserver.Client
+	Publisher       Publisher
+	Descriptors     *protoregistry.Files // optional, names gRPC message fields
+	TrackHeaders    bool                 // opt-in, records header and cookie parameters
+	Templater       *pathtemplate.Templater
+	PathTree        *pathtemplate.Tree
+	spec            *openapi3.T // optional, the document traffic is attributed to
+	specPaths       *pathtemplate.Spec
+	undocumentedMu  sync.Mutex // undocumented is reported from reassembly and the listen job
+	undocumented    map[string]struct{}
+	violations      *violations
+	mergeConflicts  *prometheus.CounterVec
+	drift           *drift
+	headers         *headerProfile
 	Log             *slog.Logger
 }
 
-func NewListener(source PacketSource, client *siegeserver.Client) (*Listener, error) {
+func NewListener(source PacketSource, publisher Publisher) (*Listener, error) {
 	f := &factory{l: nil}
 	assembler := httpassembly.NewAssembler(f)
 
@@ -45,15 +58,32 @@ func NewListener(source PacketSource, client *siegeserver.Client) (*Listener, er
 		source:          source,
 		publishInterval: 15 * time.Second,
 		requestLogs:     make(chan *RequestLog),
-		schemasToSend:   nil,
+		done:            make(chan struct{}),
+		doc:             &openapi3.T{Paths: openapi3.Paths{}},
+		docChanged:      false,
 		schemasSeen:     make(map[[md5.Size]byte]struct{}),
 		responseMetrics: make(map[ResponseMetricsKey]*ResponseMetrics),
 		registry:        prometheus.NewRegistry(),
-		Assembler:       assembler,
-		Client:          client,
-		Log:             slog.Default(),
+		headers:         newHeaderProfile(),
+		PathTree:        pathtemplate.NewTree(pathtemplate.DefaultMaxSiblings),
+		undocumented:    make(map[string]struct{}),
+		violations:      newViolations(),
+		drift:           newDrift(),
+		mergeConflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "siege",
+			Subsystem: "listener",
+			Name:      "merge_conflicts_total",
+		}, []string{"kind"}),
+		Templater: pathtemplate.New(pathtemplate.DefaultClassifiers()...),
+		Assembler: assembler,
+		Publisher: publisher,
+		Log:       slog.Default(),
 	}
 
+	listener.registry.MustRegister(listener.violations.total)
+	listener.registry.MustRegister(listener.mergeConflicts)
+	listener.registry.MustRegister(listener.drift.total)
+
 	// circular dependency cringe
 	f.l = listener
 
@@ -72,9 +102,9 @@ type ResponseMetrics struct {
 	Path     string
 	Method   string
 	Status   int
-	Total    prometheus.Counter
-	Duration prometheus.Histogram
-	Payload  prometheus.Histogram
+	Total    *MergeableCounter
+	Duration *MergeableHistogram
+	Payload  *MergeableHistogram
 }
 
 func NewResponseMetrics(path string, method string, status int) *ResponseMetrics {
@@ -93,6 +123,19 @@ func (m *ResponseMetrics) Register(r prometheus.Registerer) {
 	r.MustRegister(m.Total, m.Duration, m.Payload)
 }
 
+func (m *ResponseMetrics) Unregister(r prometheus.Registerer) {
+	r.Unregister(m.Total)
+	r.Unregister(m.Duration)
+	r.Unregister(m.Payload)
+}
+
+// Merge adds everything recorded by o, which is for the same method and status.
+func (m *ResponseMetrics) Merge(o *ResponseMetrics) {
+	m.Total.Merge(o.Total)
+	m.Duration.Merge(o.Duration)
+	m.Payload.Merge(o.Payload)
+}
+
 func (m *ResponseMetrics) HandleRequestLog(r *RequestLog) {
 	// sense check
 	if m.Path != r.Path || m.Method != r.Method || m.Status != r.Status {
@@ -117,8 +160,8 @@ func NewPrometheusMetricFactory(path string, method string, status int) Promethe
 	return PrometheusMetricFactory{Namespace: namespace, Subsystem: subsystem, Labels: labels}
 }
 
-func (f *PrometheusMetricFactory) NewCounter(name string) prometheus.Counter {
-	return prometheus.NewCounter(prometheus.CounterOpts{
+func (f *PrometheusMetricFactory) NewCounter(name string) *MergeableCounter {
+	return NewMergeableCounter(prometheus.CounterOpts{
 		Name:        name,
 		Namespace:   f.Namespace,
 		Subsystem:   f.Subsystem,
@@ -126,8 +169,8 @@ func (f *PrometheusMetricFactory) NewCounter(name string) prometheus.Counter {
 	})
 }
 
-func (f *PrometheusMetricFactory) NewHistogram(name string) prometheus.Histogram {
-	return prometheus.NewHistogram(prometheus.HistogramOpts{
+func (f *PrometheusMetricFactory) NewHistogram(name string) *MergeableHistogram {
+	return NewMergeableHistogram(prometheus.HistogramOpts{
 		Name:        name,
 		Namespace:   f.Namespace,
 		Subsystem:   f.Subsystem,
@@ -147,10 +190,30 @@ func (l *Listener) getOrCreateResponseMetrics(key ResponseMetricsKey) *ResponseM
 }
 
 func (l *Listener) handleRequestLog(r *RequestLog) {
-	sum := md5.Sum([]byte(r.Schema))
-	if _, in := l.schemasSeen[sum]; !in {
+	if !r.Exact {
+		l.templateRequestLog(r)
+	}
+	l.recordUndocumented(r)
+
+	// Most requests look exactly like one we've already merged, skip those cheaply
+	sum := md5.Sum(r.Schema)
+	if _, in := l.schemasSeen[sum]; in {
+		// the values can still be new, and every request counts towards an enum
+		if merge.ObserveEnums(l.doc.Paths, r.Paths) {
+			l.docChanged = true
+		}
+	} else {
 		l.schemasSeen[sum] = struct{}{}
-		l.schemasToSend = append(l.schemasToSend, string(r.Schema))
+		l.profileHeaders(r.Paths)
+		var m merge.Merger
+		before := l.doc
+		l.doc = m.Doc(l.doc, &openapi3.T{Paths: r.Paths})
+		l.detectDrift(before.Paths, l.doc.Paths, r.Paths)
+		for _, c := range m.Conflicts {
+			l.Log.Debug("merge conflict", "path", c.Path, "kind", c.Kind, "kept", c.Kept)
+			l.mergeConflicts.WithLabelValues(c.Kind).Inc()
+		}
+		l.docChanged = true
 	}
 
 	rm := l.getOrCreateResponseMetrics(ResponseMetricsKey{
@@ -185,7 +248,9 @@ type RequestLog struct {
 	Status   int
 	Duration float64
 	Payload  float64
-	Schema   []byte
+	Paths    openapi3.Paths
+	Schema   []byte // Paths as json, without the values kept for enums
+	Exact    bool   // Path is documented or names a gRPC method, not something to template
 }
 
 func (l *Listener) RegisterStartup() error {
@@ -196,7 +261,7 @@ func (l *Listener) RegisterStartup() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
 	defer cancel()
 
-	config, err := l.Client.Startup(ctx)
+	config, err := l.Publisher.Startup(ctx)
 	if err != nil {
 		return err
 	}
@@ -211,7 +276,7 @@ func (l *Listener) RegisterShutdown() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := l.Client.Shutdown(ctx, l.ListenerID)
+	err := l.Publisher.Shutdown(ctx, l.ListenerID)
 	if err != nil {
 		l.Log.Error("could not register shutdown", "err", err)
 		return
@@ -226,19 +291,52 @@ func (l *Listener) publish() {
 		panic(err)
 	}
 
+	// The server gets the whole merged document, but only when it has changed
+	var schemas []string
+	var components string
+	if l.docChanged {
+		// objects shared between operations are published once, as components
+		doc, err := copyDoc(l.doc)
+		if err != nil {
+			panic(err)
+		}
+		hoistSchemas(doc)
+
+		bs, err := json.Marshal(doc.Paths)
+		if err != nil {
+			panic(err)
+		}
+		schemas = []string{string(bs)}
+
+		if doc.Components != nil {
+			bs, err := json.Marshal(doc.Components)
+			if err != nil {
+				panic(err)
+			}
+			components = string(bs)
+		}
+	}
+
+	// samples are only let go of once they've been published, a failed update sends
+	// them again next time
 	update := siegeserver.ListenerUpdate{
 		ListenerID: l.ListenerID,
-		Schemas:    l.schemasToSend,
+		Schemas:    schemas,
+		Components: components,
 		Metrics:    metrics,
+		Violations: l.violations.pending(),
+		Drift:      l.drift.pending(),
 	}
 
-	err = l.Client.Update(context.Background(), update)
+	err = l.Publisher.Update(context.Background(), update)
 	if err != nil {
 		l.Log.Error("listener/update failed", "err", err)
 		return
 	}
 
-	l.schemasToSend = nil
+	l.violations.published(len(update.Violations))
+	l.drift.published(len(update.Drift))
+	l.docChanged = false
 	l.Log.Debug("listener/update")
 }
 
@@ -250,21 +348,53 @@ func (l *Listener) ListenJob(ctx context.Context, wg *sync.WaitGroup) {
 
 	flushTicker := time.NewTicker(time.Minute)
 	defer flushTicker.Stop()
+	var clock captureClock
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 
-		case packet := <-l.source.Packets():
+		case packet, ok := <-l.source.Packets():
+			if !ok {
+				l.Log.Debug("packet source exhausted")
+				l.Assembler.Close()
+				return
+			}
+			clock.observe(packet.Metadata().Timestamp)
 			l.Assembler.Assemble(packet)
 
 		case <-flushTicker.C:
-			l.Assembler.FlushCloseOlderThan(time.Now().Add(time.Minute * -2))
+			if now, ok := clock.now(); ok {
+				l.Assembler.FlushCloseOlderThan(now.Add(time.Minute * -2))
+			}
 		}
 	}
 }
 
+// captureClock tells the time as the packets see it. Connections are closed by their
+// capture timestamps, which for a replayed file can be from long ago, so the time is
+// the latest timestamp seen plus however long it's been since it arrived.
+type captureClock struct {
+	latest  time.Time
+	arrived time.Time
+}
+
+func (c *captureClock) observe(ts time.Time) {
+	if ts.After(c.latest) {
+		c.latest = ts
+		c.arrived = time.Now()
+	}
+}
+
+// now is false until there's been a packet to go by.
+func (c *captureClock) now() (time.Time, bool) {
+	if c.latest.IsZero() {
+		return time.Time{}, false
+	}
+	return c.latest.Add(time.Since(c.arrived)), true
+}
+
 func (l *Listener) PublishJob(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
@@ -279,7 +409,12 @@ func (l *Listener) PublishJob(ctx context.Context, wg *sync.WaitGroup) {
 		case <-ctx.Done():
 			return
 
-		case r := <-l.requestLogs:
+		case r, ok := <-l.requestLogs:
+			if !ok {
+				l.publish()
+				close(l.done)
+				return
+			}
 			l.handleRequestLog(r)
 
 		case <-publishTicker.C:
@@ -290,6 +425,14 @@ func (l *Listener) PublishJob(ctx context.Context, wg *sync.WaitGroup) {
 
 func (l *Listener) ReassembleJob(ctx context.Context, wg *sync.WaitGroup) {
 	l.Assembler.ReassembleJob(ctx, wg)
+	// streams only send request logs from within the reassemble job
+	close(l.requestLogs)
+}
+
+// Done is closed once the packet source is exhausted and everything it produced has
+// been published. It is never closed for a live source.
+func (l *Listener) Done() <-chan struct{} {
+	return l.done
 }
 
 type factory struct {
@@ -330,8 +473,17 @@ func (s *stream) ReassembledRequestResponse(req []byte, res []byte, duration flo
 		return
 	}
 
-	// Skip anything that isn't JSON
-	if !strings.Contains(r.Header.Get("Content-Type"), "json") && !strings.Contains(w.Header.Get("Content-Type"), "json") {
+	if isGrpc(r.Header.Get("Content-Type")) {
+		if err := s.Listener.handleGrpc(r, w, payload, duration); err != nil {
+			s.Log.Error("could not handle grpc", "err", err, "path", r.URL.Path, "status", w.Status)
+			return
+		}
+		s.Log.Debug("handled grpc", "path", r.URL.Path, "status", w.Status)
+		return
+	}
+
+	// Skip anything we can't infer a schema from
+	if !isInferable(r.Header.Get("Content-Type")) && !isInferable(w.Header.Get("Content-Type")) {
 		s.Log.Debug("skipped", "method", r.Method, "path", r.URL.Path, "status", w.Status)
 		return
 	}
@@ -368,89 +520,68 @@ type response struct {
 
 func (l *Listener) handleRequestResponse(req *request, res *response, payload float64, duration float64) {
 
+	path, params, documented := l.templatePath(req.inner.URL.Path)
+
 	op := openapi3.Operation{}
-	// header info is bloating schemas a lot, probably want to track across the api as
-	// a whole instead of just per endpoint? or track separately? Not sure about tracking
-	// every combination of header.
-	//
-	//for k, _ := range req.inner.Header {
-	//	p := &openapi3.ParameterRef{Value: &openapi3.Parameter{
-	//		Name: k,
-	//		In:   "header",
-	//	}}
-	//
-	//	op.Parameters = append(op.Parameters, p)
-	//}
+	op.Parameters = append(params, queryParameters(req.inner.URL.Query())...)
+	if l.TrackHeaders {
+		// headers common across the api are moved out to components when merged
+		op.Parameters = append(op.Parameters, headerParameters(req.inner)...)
+	}
 	op.RequestBody = l.handleRequestResponseProcRequestBody(req, res)
 	op.Responses = l.handleRequestResponseProcResponses(req, res)
 
+	if specOp := l.checkDocumented(path, documented, req.inner.Method, res.inner.StatusCode, &op); specOp != nil {
+		l.validate(req, res, path, specOp)
+	}
+
+	pathItem := newPathItem(req.inner.Method, &op)
+
+	l.enqueueRequestLog(path, req.inner.Method, res.inner.StatusCode, pathItem, payload, duration, documented)
+}
+
+func newPathItem(method string, op *openapi3.Operation) *openapi3.PathItem {
 	pathItem := openapi3.PathItem{}
-	switch req.inner.Method {
+	switch method {
 	case http.MethodConnect:
-		pathItem.Connect = &op
+		pathItem.Connect = op
 	case http.MethodDelete:
-		pathItem.Delete = &op
+		pathItem.Delete = op
 	case http.MethodGet:
-		pathItem.Get = &op
+		pathItem.Get = op
 	case http.MethodHead:
-		pathItem.Head = &op
+		pathItem.Head = op
 	case http.MethodOptions:
-		pathItem.Options = &op
+		pathItem.Options = op
 	case http.MethodPatch:
-		pathItem.Patch = &op
+		pathItem.Patch = op
 	case http.MethodPost:
-		pathItem.Post = &op
+		pathItem.Post = op
 	case http.MethodPut:
-		pathItem.Put = &op
+		pathItem.Put = op
 	case http.MethodTrace:
-		pathItem.Trace = &op
+		pathItem.Trace = op
 	default:
 		panic("Unknown request method")
 	}
+	return &pathItem
+}
 
-	nparams := 1
-	parts := strings.Split(req.inner.URL.Path, "/")
-	resparts := make([]string, len(parts))
-	for i, p := range parts {
-		if _, err := strconv.Atoi(p); err == nil {
-			resparts[i] = fmt.Sprintf("{arg%d}", nparams)
-			a := &openapi3.ParameterRef{Value: &openapi3.Parameter{
-				Name:   fmt.Sprintf("arg%d", nparams),
-				In:     "path",
-				Schema: &openapi3.SchemaRef{Value: &openapi3.Schema{Type: "integer"}},
-			}}
-			op.Parameters = append(op.Parameters, a)
-			nparams += 1
-		} else if _, err := uuid.Parse(p); err == nil {
-			resparts[i] = fmt.Sprintf("{arg%d}", nparams)
-			a := &openapi3.ParameterRef{Value: &openapi3.Parameter{
-				Name:   fmt.Sprintf("arg%d", nparams),
-				In:     "path",
-				Schema: &openapi3.SchemaRef{Value: &openapi3.Schema{Type: "string", Format: "uuid"}},
-			}}
-			op.Parameters = append(op.Parameters, a)
-			nparams += 1
-		} else {
-			resparts[i] = p
-		}
-	}
-
-	path := strings.Join(resparts, "/")
-	ps := openapi3.Paths{path: &pathItem}
-	bs, err := json.Marshal(ps)
-	if err != nil {
-		panic(err)
-	}
+func (l *Listener) enqueueRequestLog(path string, method string, status int, pathItem *openapi3.PathItem, payload float64, duration float64, exact bool) {
+	ps := openapi3.Paths{path: pathItem}
+	bs := schemaShape(ps)
 
 	l.Log.Debug("enqueuing request log")
 
 	l.requestLogs <- &RequestLog{
 		Path:     path,
-		Method:   req.inner.Method,
-		Status:   res.inner.StatusCode,
+		Method:   method,
+		Status:   status,
 		Duration: duration,
 		Payload:  payload,
+		Paths:    ps,
 		Schema:   bs,
+		Exact:    exact,
 	}
 }
 
@@ -460,20 +591,15 @@ func (l *Listener) handleRequestResponseProcRequestBody(req *request, res *respo
 		return nil
 	}
 
-	mt := openapi3.NewMediaType()
-	if strings.Contains(req.inner.Header.Get("Content-Type"), "json") {
-		sch, err := infer.ParseSampleBodyBytes(req.body)
-		if err != nil {
-			l.Log.Warn("error parsing request body as json", "err", err)
-			// could not parse json?
-			return nil
-		}
-		mt.Schema = sch.NewRef()
+	key, mt, err := inferMediaType(req.inner.Header.Get("Content-Type"), req.body)
+	if err != nil {
+		l.Log.Warn("error parsing request body", "err", err, "contentType", key)
+		return nil
 	}
 
 	rb := openapi3.NewRequestBody()
 	rb.Content = openapi3.Content{}
-	rb.Content[req.inner.Header.Get("Content-Type")] = mt
+	rb.Content[key] = mt
 	return &openapi3.RequestBodyRef{Value: rb}
 }
 
@@ -487,30 +613,39 @@ func (l *Listener) handleRequestResponseProcResponses(req *request, res *respons
 		return r
 	}
 
-	mt := openapi3.NewMediaType()
-	if strings.Contains(res.inner.Header.Get("Content-Type"), "json") {
-		sch, err := infer.ParseSampleBodyBytes(res.body)
-		if err != nil {
-			l.Log.Warn("error parsing response body as json", "err", err)
-			return nil
-		}
-		mt.Schema = sch.NewRef()
+	key, mt, err := inferMediaType(res.inner.Header.Get("Content-Type"), res.body)
+	if err != nil {
+		l.Log.Warn("error parsing response body", "err", err, "contentType", key)
+		return nil
 	}
 
 	rs := openapi3.NewResponse()
 	rs.Content = openapi3.Content{}
-	rs.Content[res.inner.Header.Get("Content-Type")] = mt
-
-	// same thoughts as the request headers
-	//if len(res.inner.Header) > 0 {
-	//	rs.Headers = openapi3.Headers{}
-	//}
-	//
-	//for k, _ := range res.inner.Header {
-	//	rs.Headers[k] = &openapi3.HeaderRef{Value: &openapi3.Header{}}
-	//}
+	rs.Content[key] = mt
+	if l.TrackHeaders {
+		rs.Headers = responseHeaders(res.inner)
+	}
 
 	return openapi3.Responses{
 		strconv.Itoa(res.inner.StatusCode): &openapi3.ResponseRef{Value: rs},
 	}
 }
+
+// schemaShape is paths as json without the values enum tracking keeps, so samples that
+// only differ in their values look the same.
+func schemaShape(paths openapi3.Paths) []byte {
+	bs, err := json.Marshal(paths)
+	if err != nil {
+		panic(err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		panic(err)
+	}
+	forgetSamples(v)
+	bs, err = json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
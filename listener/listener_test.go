@@ -0,0 +1,75 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/diff"
+	"github.com/siegeai/siegelistener/merge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleValuesDontDefeatSchemasSeen(t *testing.T) {
+	l, err := NewListener(nil, nil)
+	assert.Nil(t, err)
+
+	n := 1000
+	for i := 0; i < n; i++ {
+		body := fmt.Sprintf(`{"id": %d, "user": "user%d", "status": "active"}`, i, i)
+		ps := openapi3.Paths{"/orders": newPathItem(http.MethodGet, jsonOperation(t, body))}
+		l.handleRequestLog(&RequestLog{Path: "/orders", Method: http.MethodGet, Status: 200, Paths: ps, Schema: schemaShape(ps), Exact: true})
+	}
+
+	// user shows up as a different value each time, it's the same shape nonetheless
+	assert.Len(t, l.schemasSeen, 1, l.schemasSeen)
+
+	s := l.doc.Paths["/orders"].Get.Responses["200"].Value.Content["application/json"].Schema.Value
+	status := s.Properties["status"].Value
+	assert.Equal(t, []interface{}{"active"}, status.Enum)
+	assert.Equal(t, n, status.Extensions[merge.ObservationsExtension])
+	assert.Nil(t, s.Properties["user"].Value.Enum)
+	assert.NotContains(t, s.Properties["user"].Value.Extensions, merge.EnumValuesExtension)
+	assert.Nil(t, s.Properties["id"].Value.Extensions)
+}
+
+func TestCaptureClock(t *testing.T) {
+	var c captureClock
+	_, ok := c.now()
+	assert.False(t, ok)
+
+	// a capture from a year ago keeps its own time
+	then := time.Now().AddDate(-1, 0, 0)
+	c.observe(then)
+	c.observe(then.Add(-time.Hour))
+	now, ok := c.now()
+	assert.True(t, ok)
+	assert.WithinDuration(t, then, now, time.Second)
+}
+
+func TestPublishKeepsSamplesUntilUpdated(t *testing.T) {
+	p := &capturePublisher{err: errors.New("unreachable")}
+	l, err := NewListener(nil, p)
+	assert.Nil(t, err)
+
+	l.violations.record(http.MethodGet, "/users", 200, violationSchema, "a")
+	l.drift.record(http.MethodGet, "/users", diff.Change{Path: "/x", Kind: diff.ChangeAdded}, nil, nil)
+	l.publish()
+	assert.Empty(t, p.updates)
+
+	// recorded while the update was failing, it goes out along with the rest
+	l.violations.record(http.MethodGet, "/users", 200, violationSchema, "b")
+	p.err = nil
+	l.publish()
+	assert.Len(t, p.updates, 1)
+	assert.Len(t, p.updates[0].Violations, 2)
+	assert.Len(t, p.updates[0].Drift, 1)
+
+	l.publish()
+	assert.Len(t, p.updates, 2)
+	assert.Empty(t, p.updates[1].Violations)
+	assert.Empty(t, p.updates[1].Drift)
+}
@@ -0,0 +1,91 @@
+package listener
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The prometheus counters and histograms can't absorb one another, but when a set of
+// concrete paths collapses into a template their metrics need to be combined. These
+// are just enough of a counter and histogram to do that. Neither is safe for
+// concurrent use, both are only touched from the publish job.
+
+type MergeableCounter struct {
+	desc  *prometheus.Desc
+	value float64
+}
+
+func NewMergeableCounter(opts prometheus.CounterOpts) *MergeableCounter {
+	name := prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)
+	return &MergeableCounter{desc: prometheus.NewDesc(name, opts.Help, nil, opts.ConstLabels)}
+}
+
+func (c *MergeableCounter) Inc() {
+	c.value++
+}
+
+func (c *MergeableCounter) Merge(o *MergeableCounter) {
+	c.value += o.value
+}
+
+func (c *MergeableCounter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *MergeableCounter) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, c.value)
+}
+
+type MergeableHistogram struct {
+	desc    *prometheus.Desc
+	buckets []float64
+	counts  []uint64 // per bucket, not cumulative
+	count   uint64
+	sum     float64
+}
+
+func NewMergeableHistogram(opts prometheus.HistogramOpts) *MergeableHistogram {
+	buckets := opts.Buckets
+	if buckets == nil {
+		buckets = prometheus.DefBuckets
+	}
+	name := prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)
+	return &MergeableHistogram{
+		desc:    prometheus.NewDesc(name, opts.Help, nil, opts.ConstLabels),
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *MergeableHistogram) Observe(v float64) {
+	// anything past the last bucket only counts towards +Inf
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Merge adds the observations of o, which must have the same buckets.
+func (h *MergeableHistogram) Merge(o *MergeableHistogram) {
+	for i := range h.counts {
+		h.counts[i] += o.counts[i]
+	}
+	h.count += o.count
+	h.sum += o.sum
+}
+
+func (h *MergeableHistogram) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.desc
+}
+
+func (h *MergeableHistogram) Collect(ch chan<- prometheus.Metric) {
+	cumulative := make(map[float64]uint64, len(h.buckets))
+	var n uint64
+	for i, b := range h.buckets {
+		n += h.counts[i]
+		cumulative[b] = n
+	}
+	ch <- prometheus.MustNewConstHistogram(h.desc, h.count, h.sum, cumulative)
+}
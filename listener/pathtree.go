@@ -0,0 +1,78 @@
+package listener
+
+import (
+	"crypto/md5"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/merge"
+)
+
+// templateRequestLog runs the request's path through the path tree. If the tree has
+// collapsed part of it into a parameter the request log is rewritten to match, and
+// if the request made the tree collapse something everything recorded for the paths
+// involved is folded into the new template.
+func (l *Listener) templateRequestLog(r *RequestLog) {
+	path, params, collapsed := l.PathTree.Insert(r.Path)
+	if collapsed {
+		l.collapsePaths()
+	}
+	if path == r.Path {
+		return
+	}
+
+	item := r.Paths[r.Path]
+	addPathParameters(item, params)
+
+	r.Path = path
+	r.Paths = openapi3.Paths{path: item}
+	r.Schema = schemaShape(r.Paths)
+}
+
+// collapsePaths moves the schemas and metrics of concrete paths under the template
+// the path tree has for them now.
+func (l *Listener) collapsePaths() {
+	var keys []string
+	for k := range l.doc.Paths {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		path, params := l.PathTree.Lookup(k)
+		if path == k {
+			continue
+		}
+		item := l.doc.Paths[k]
+		delete(l.doc.Paths, k)
+		addPathParameters(item, params)
+		l.doc.Paths[path] = new(merge.Merger).PathItem(l.doc.Paths[path], item)
+	}
+
+	var metrics []ResponseMetricsKey
+	for k := range l.responseMetrics {
+		metrics = append(metrics, k)
+	}
+	for _, k := range metrics {
+		path, _ := l.PathTree.Lookup(k.Path)
+		if path == k.Path {
+			continue
+		}
+		m := l.responseMetrics[k]
+		m.Unregister(l.registry)
+		delete(l.responseMetrics, k)
+		l.getOrCreateResponseMetrics(ResponseMetricsKey{Path: path, Method: k.Method, Status: k.Status}).Merge(m)
+	}
+
+	// everything in here was for paths that don't exist anymore
+	l.schemasSeen = make(map[[md5.Size]byte]struct{})
+	l.docChanged = true
+}
+
+// addPathParameters adds params to each operation in item that doesn't have them.
+func addPathParameters(item *openapi3.PathItem, params openapi3.Parameters) {
+	for _, op := range item.Operations() {
+		for _, p := range params {
+			if op.Parameters.GetByInAndName(p.Value.In, p.Value.Name) == nil {
+				op.Parameters = append(op.Parameters, p)
+			}
+		}
+	}
+}
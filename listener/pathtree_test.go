@@ -0,0 +1,44 @@
+package listener
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/pathtemplate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapseMergesSchemasAndMetrics(t *testing.T) {
+	l, err := NewListener(nil, nil)
+	assert.Nil(t, err)
+	l.PathTree = pathtemplate.NewTree(2)
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		op := &openapi3.Operation{Responses: openapi3.NewResponses()}
+		path := "/users/" + name
+		r := &RequestLog{
+			Path:   path,
+			Method: http.MethodGet,
+			Status: http.StatusOK,
+			Paths:  openapi3.Paths{path: newPathItem(http.MethodGet, op)},
+			Schema: []byte(path),
+		}
+		l.handleRequestLog(r)
+	}
+
+	assert.Len(t, l.doc.Paths, 1)
+	item := l.doc.Paths["/users/{userId}"]
+	assert.NotNil(t, item)
+	assert.NotNil(t, item.Get.Parameters.GetByInAndName(openapi3.ParameterInPath, "userId"))
+
+	assert.Len(t, l.responseMetrics, 1)
+	m := l.responseMetrics[ResponseMetricsKey{Path: "/users/{userId}", Method: http.MethodGet, Status: http.StatusOK}]
+	assert.Equal(t, float64(3), m.Total.value)
+	assert.Equal(t, uint64(3), m.Duration.count)
+
+	text, err := l.encodeMetrics()
+	assert.Nil(t, err)
+	assert.Contains(t, text, `siege_listener_http_response_total{method="GET",path="/users/{userId}",status="200"} 3`)
+	assert.NotContains(t, text, "alice")
+}
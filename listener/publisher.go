@@ -0,0 +1,17 @@
+package listener
+
+import (
+	"context"
+
+	"github.com/siegeai/siegelistener/integrations/siegeserver"
+)
+
+// Publisher is wherever the listener sends its schemas and metrics. The siege server
+// is the usual one, but anything that can take an update will do.
+type Publisher interface {
+	Startup(ctx context.Context) (*siegeserver.ListenerConfig, error)
+	Shutdown(ctx context.Context, listenerID string) error
+	Update(ctx context.Context, args siegeserver.ListenerUpdate) error
+}
+
+var _ Publisher = (*siegeserver.Client)(nil)
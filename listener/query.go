@@ -0,0 +1,48 @@
+package listener
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/infer"
+)
+
+// queryParameters turns every key in the query string into a parameter. They're all
+// required as far as this one request can tell, merging with other requests to the
+// same operation relaxes that for keys that aren't always sent.
+func queryParameters(q url.Values) openapi3.Parameters {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ps := make(openapi3.Parameters, 0, len(keys))
+	for _, k := range keys {
+		vs := q[k]
+		schema := infer.ParseSampleQueryValues(vs)
+		if infer.IsSensitiveName(k) {
+			infer.ForgetValues(schema)
+		}
+		p := &openapi3.Parameter{
+			Name:     k,
+			In:       openapi3.ParameterInQuery,
+			Required: true,
+			Schema:   schema.NewRef(),
+		}
+		if len(vs) > 1 {
+			// ?id=1&id=2 is the exploded form style
+			explode := true
+			p.Style = openapi3.SerializationForm
+			p.Explode = &explode
+		}
+		for _, v := range vs {
+			if v == "" {
+				p.AllowEmptyValue = true
+			}
+		}
+		ps = append(ps, &openapi3.ParameterRef{Value: p})
+	}
+	return ps
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/google/gopacket/pcap"
 )
 
+// PacketSource provides the packets to reassemble. A source that runs out of packets,
+// like a capture file, closes the channel to signal that it is done.
 type PacketSource interface {
 	Packets() chan gopacket.Packet
 }
@@ -22,13 +24,16 @@ func NewPacketSourceLive(device, filter string) (PacketSource, error) {
 	return gopacket.NewPacketSource(handle, handle.LinkType()), nil
 }
 
-//func NewPacketSourceFile(fileName string) (PacketSource, error) {
-//	handle, err := pcap.OpenOffline(fileName)
-//	if err != nil {
-//		return nil, err
-//	}
-//	if err = handle.SetBPFFilter("tcp"); err != nil {
-//		return nil, err
-//	}
-//	return gopacket.NewPacketSource(handle, handle.LinkType()), nil
-//}
+// NewPacketSourceFile replays a pcap or pcapng capture. The packet channel is closed
+// once the end of the file is reached.
+func NewPacketSourceFile(fileName, filter string) (PacketSource, error) {
+	handle, err := pcap.OpenOffline(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if err = handle.SetBPFFilter(filter); err != nil {
+		handle.Close()
+		return nil, err
+	}
+	return gopacket.NewPacketSource(handle, handle.LinkType()), nil
+}
@@ -0,0 +1,108 @@
+package listener
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/pathtemplate"
+)
+
+// undocumentedExtension marks operations and responses seen in traffic that the
+// loaded spec doesn't describe.
+const undocumentedExtension = "x-siege-undocumented"
+
+// LoadSpec reads an existing OpenAPI 3 document, json or yaml.
+func LoadSpec(fileName string) (*openapi3.T, error) {
+	return openapi3.NewLoader().LoadFromFile(fileName)
+}
+
+// UseSpec has requests matching one of doc's paths attributed to that template rather
+// than one we guess, and has everything doc doesn't describe reported.
+func (l *Listener) UseSpec(doc *openapi3.T) {
+	l.spec = doc
+	l.specPaths = pathtemplate.NewSpec(doc.Paths, doc.Servers)
+}
+
+// templatePath returns the template for path, from the spec if it documents one.
+func (l *Listener) templatePath(path string) (string, openapi3.Parameters, bool) {
+	if l.specPaths != nil {
+		if template, values, ok := l.specPaths.Match(path); ok {
+			var params openapi3.Parameters
+			for _, p := range strings.Split(template, "/") {
+				if name := strings.Trim(p, "{}"); name != p {
+					params = append(params, l.Templater.Parameter(name, values[name]))
+				}
+			}
+			return template, params, true
+		}
+	}
+
+	path, params := l.Templater.Template(path)
+	return path, params, false
+}
+
+// checkDocumented marks op, or the response for status, when the spec doesn't have
+// them. Each is logged the first time it's seen. It returns the spec's operation so
+// the traffic can be validated against it.
+func (l *Listener) checkDocumented(template string, documented bool, method string, status int, op *openapi3.Operation) *openapi3.Operation {
+	if l.spec == nil {
+		return nil
+	}
+
+	var specOp *openapi3.Operation
+	if documented {
+		specOp = l.spec.Paths[template].GetOperation(method)
+	}
+
+	if specOp == nil {
+		// reported by recordUndocumented, once the path tree has had its say on template
+		op.Extensions = map[string]interface{}{undocumentedExtension: true}
+		return nil
+	}
+
+	code := strconv.Itoa(status)
+	if specOp.Responses[code] != nil || specOp.Responses[code[:1]+"XX"] != nil || specOp.Responses.Default() != nil {
+		return specOp
+	}
+
+	if rs := op.Responses[code]; rs != nil && rs.Value != nil {
+		rs.Value.Extensions = map[string]interface{}{undocumentedExtension: true}
+	}
+	l.violations.record(method, template, status, violationUndocumentedStatus, "status is not in the spec")
+	l.reportUndocumented("undocumented status", template, method, status)
+	return specOp
+}
+
+// recordUndocumented reports r's operation when checkDocumented found it isn't in the
+// spec. r has been templated by then, so it's counted under the path the doc has it.
+func (l *Listener) recordUndocumented(r *RequestLog) {
+	item := r.Paths[r.Path]
+	if item == nil {
+		return
+	}
+	op := item.GetOperation(r.Method)
+	if op == nil || op.Extensions[undocumentedExtension] != true {
+		return
+	}
+	l.violations.record(r.Method, r.Path, r.Status, violationUndocumentedOperation, "operation is not in the spec")
+	l.reportUndocumented("undocumented operation", r.Path, r.Method, 0)
+}
+
+func (l *Listener) reportUndocumented(msg string, template string, method string, status int) {
+	l.undocumentedMu.Lock()
+	defer l.undocumentedMu.Unlock()
+
+	key := method + " " + template + " " + strconv.Itoa(status)
+	if _, in := l.undocumented[key]; in {
+		return
+	}
+	l.undocumented[key] = struct{}{}
+
+	if status == 0 {
+		l.Log.Warn(msg, "method", method, "path", template)
+	} else {
+		l.Log.Warn(msg, "method", method, "path", template, "status", status, "statusText", http.StatusText(status))
+	}
+}
@@ -0,0 +1,64 @@
+package listener
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/siegeai/siegelistener/pathtemplate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecAttributesAndReportsUndocumented(t *testing.T) {
+	l, err := NewListener(nil, nil)
+	assert.Nil(t, err)
+
+	get := openapi3.NewOperation()
+	get.Responses = openapi3.Responses{"200": &openapi3.ResponseRef{Value: openapi3.NewResponse()}}
+	l.UseSpec(&openapi3.T{Paths: openapi3.Paths{"/users/{name}": &openapi3.PathItem{Get: get}}})
+
+	path, params, documented := l.templatePath("/users/alice")
+	assert.True(t, documented)
+	assert.Equal(t, "/users/{name}", path)
+	assert.Equal(t, "name", params[0].Value.Name)
+
+	op := &openapi3.Operation{Responses: openapi3.Responses{
+		"404": &openapi3.ResponseRef{Value: openapi3.NewResponse()},
+	}}
+	l.checkDocumented(path, documented, http.MethodGet, http.StatusNotFound, op)
+	assert.Nil(t, op.Extensions)
+	assert.Equal(t, true, op.Responses["404"].Value.Extensions[undocumentedExtension])
+
+	op = &openapi3.Operation{}
+	l.checkDocumented(path, documented, http.MethodDelete, http.StatusOK, op)
+	assert.Equal(t, true, op.Extensions[undocumentedExtension])
+
+	path, _, documented = l.templatePath("/orders/7")
+	assert.False(t, documented)
+	assert.Equal(t, "/orders/{orderId}", path)
+}
+
+func TestUndocumentedCountedUnderCollapsedPath(t *testing.T) {
+	l, err := NewListener(nil, nil)
+	assert.Nil(t, err)
+	l.PathTree = pathtemplate.NewTree(2)
+	l.UseSpec(&openapi3.T{Paths: openapi3.Paths{"/orders": &openapi3.PathItem{Get: openapi3.NewOperation()}}})
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		req, res := parseExchange(t,
+			"GET /users/"+name+" HTTP/1.1\r\nHost: x\r\n\r\n",
+			"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+		)
+		go l.handleRequestResponse(req, res, 0, 0)
+		l.handleRequestLog(<-l.requestLogs)
+	}
+
+	vs := l.violations.drain()
+	assert.Len(t, vs, 3)
+	assert.Equal(t, violationUndocumentedOperation, vs[2].Kind)
+	assert.Equal(t, "/users/{userId}", vs[2].Path)
+
+	text, err := l.encodeMetrics()
+	assert.Nil(t, err)
+	assert.Contains(t, text, `siege_listener_contract_violations_total{kind="undocumented_operation",method="GET",path="/users/{userId}"} 1`)
+}
@@ -0,0 +1,232 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/siegeai/siegelistener/integrations/siegeserver"
+)
+
+// maxViolationSamples is how many violations of each kind we keep per operation
+// between publishes, everything past that is only counted.
+const maxViolationSamples = 10
+
+const (
+	violationUndocumentedOperation = "undocumented_operation"
+	violationUndocumentedStatus    = "undocumented_status"
+	violationMissingRequired       = "missing_required"
+	violationWrongType             = "wrong_type"
+	violationContentType           = "unexpected_content_type"
+	violationSchema                = "schema_mismatch"
+	violationInvalid               = "invalid"
+)
+
+// violations counts contract violations and keeps a sample of them. Requests are
+// validated as they're reassembled and published from another goroutine, hence the
+// lock.
+type violations struct {
+	total *prometheus.CounterVec
+
+	mu      sync.Mutex
+	counts  map[string]int
+	samples []siegeserver.Violation
+}
+
+func newViolations() *violations {
+	return &violations{
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "siege",
+			Subsystem: "listener",
+			Name:      "contract_violations_total",
+		}, []string{"path", "method", "kind"}),
+		counts: make(map[string]int),
+	}
+}
+
+func (v *violations) record(method, path string, status int, kind, msg string) {
+	v.total.WithLabelValues(path, method, kind).Inc()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := method + " " + path + " " + kind
+	if v.counts[key] >= maxViolationSamples {
+		return
+	}
+	v.counts[key]++
+	v.samples = append(v.samples, siegeserver.Violation{
+		Time:    time.Now(),
+		Method:  method,
+		Path:    path,
+		Status:  status,
+		Kind:    kind,
+		Message: msg,
+	})
+}
+
+// pending returns the samples that haven't been published yet.
+func (v *violations) pending() []siegeserver.Violation {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]siegeserver.Violation(nil), v.samples...)
+}
+
+// published forgets the first n samples, pending handed them over and they've made it
+// to the publisher. Anything recorded since stays.
+func (v *violations) published(n int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.samples = v.samples[n:]
+	if len(v.samples) == 0 {
+		v.samples = nil
+	}
+	v.counts = make(map[string]int)
+}
+
+// drain hands over the samples kept since the last call.
+func (v *violations) drain() []siegeserver.Violation {
+	res := v.pending()
+	v.published(len(res))
+	return res
+}
+
+// validate checks a request and its response against the operation in the spec.
+func (l *Listener) validate(req *request, res *response, template string, specOp *openapi3.Operation) {
+	_, values, _ := l.specPaths.Match(req.inner.URL.Path)
+
+	method := req.inner.Method
+	status := res.inner.StatusCode
+
+	route := &routers.Route{
+		Spec:      l.spec,
+		Path:      template,
+		PathItem:  l.spec.Paths[template],
+		Method:    method,
+		Operation: specOp,
+	}
+	opts := &openapi3filter.Options{
+		MultiError: true,
+		// we can't check credentials, only their shape
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	// the bodies have been read and decoded already
+	r := req.inner.Clone(context.Background())
+	r.Header.Del("Content-Encoding")
+	r.Body = io.NopCloser(bytes.NewReader(req.body))
+
+	in := &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: values,
+		Route:      route,
+		Options:    opts,
+	}
+	if err := openapi3filter.ValidateRequest(context.Background(), in); err != nil {
+		for _, v := range classifyViolations(err, "request") {
+			l.violations.record(method, template, status, v.kind, v.msg)
+		}
+	}
+
+	out := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: in,
+		Status:                 status,
+		Header:                 res.inner.Header,
+		Body:                   io.NopCloser(bytes.NewReader(res.body)),
+		Options:                opts,
+	}
+	if err := openapi3filter.ValidateResponse(context.Background(), out); err != nil {
+		for _, v := range classifyViolations(err, "response") {
+			l.violations.record(method, template, status, v.kind, v.msg)
+		}
+	}
+}
+
+type violation struct {
+	kind string
+	msg  string
+}
+
+// classifyViolations flattens the errors from a validator and sorts them into kinds.
+// The messages are rebuilt from where the problem is and why, the validators' own
+// messages include the offending values and those could be anything.
+func classifyViolations(err error, where string) []violation {
+	var me openapi3.MultiError
+	if errors.As(err, &me) {
+		var res []violation
+		for _, e := range me {
+			res = append(res, classifyViolations(e, where)...)
+		}
+		return res
+	}
+
+	var se *openapi3.SchemaError
+	if errors.As(err, &se) {
+		kind := violationSchema
+		switch se.SchemaField {
+		case "required":
+			kind = violationMissingRequired
+		case "type":
+			kind = violationWrongType
+		}
+		if se.Origin != nil {
+			return classifyViolations(se.Origin, where)
+		}
+		return []violation{{kind: kind, msg: fmt.Sprintf("%s %s: %s", where, jsonPointer(se), se.Reason)}}
+	}
+
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		if reqErr.Parameter != nil {
+			where = fmt.Sprintf("%s %s parameter %q", where, reqErr.Parameter.In, reqErr.Parameter.Name)
+		}
+		if errors.Is(reqErr.Err, openapi3filter.ErrInvalidRequired) {
+			return []violation{{kind: violationMissingRequired, msg: where + " is missing"}}
+		}
+		if reqErr.Err != nil && !isContentTypeReason(reqErr.Reason) {
+			if vs := classifyViolations(reqErr.Err, where); len(vs) > 0 {
+				return vs
+			}
+		}
+		return []violation{reasonViolation(where, reqErr.Reason)}
+	}
+
+	var resErr *openapi3filter.ResponseError
+	if errors.As(err, &resErr) {
+		if resErr.Err != nil && !isContentTypeReason(resErr.Reason) {
+			if vs := classifyViolations(resErr.Err, where); len(vs) > 0 {
+				return vs
+			}
+		}
+		return []violation{reasonViolation(where, resErr.Reason)}
+	}
+
+	return []violation{{kind: violationInvalid, msg: where + " is invalid"}}
+}
+
+func reasonViolation(where, reason string) violation {
+	if isContentTypeReason(reason) {
+		return violation{kind: violationContentType, msg: where + " has an undocumented content type"}
+	}
+	// reasons that quote a value have it after a colon
+	reason, _, _ = strings.Cut(reason, ":")
+	return violation{kind: violationInvalid, msg: fmt.Sprintf("%s: %s", where, reason)}
+}
+
+func isContentTypeReason(reason string) bool {
+	return strings.Contains(reason, "Content-Type has unexpected value")
+}
+
+func jsonPointer(se *openapi3.SchemaError) string {
+	return "/" + strings.Join(se.JSONPointer(), "/")
+}
@@ -0,0 +1,102 @@
+package listener
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+const validateSpec = `{
+  "openapi": "3.0.0",
+  "info": {"title": "test", "version": "1"},
+  "paths": {
+    "/users/{id}": {
+      "put": {
+        "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+        "requestBody": {"content": {"application/json": {"schema": {
+          "type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}
+        }}}},
+        "responses": {"200": {"description": "", "content": {"application/json": {"schema": {
+          "type": "object", "properties": {"age": {"type": "integer"}}
+        }}}}}
+      }
+    }
+  }
+}`
+
+func parseExchange(t *testing.T, req, res string) (*request, *response) {
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(req)))
+	assert.Nil(t, err)
+	w, err := http.ReadResponse(bufio.NewReader(strings.NewReader(res)), r)
+	assert.Nil(t, err)
+
+	reqBody := req[strings.Index(req, "\r\n\r\n")+4:]
+	resBody := res[strings.Index(res, "\r\n\r\n")+4:]
+	return &request{inner: r, body: []byte(reqBody)}, &response{inner: w, body: []byte(resBody)}
+}
+
+func TestValidateRecordsViolations(t *testing.T) {
+	l, err := NewListener(nil, nil)
+	assert.Nil(t, err)
+
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(validateSpec))
+	assert.Nil(t, err)
+	l.UseSpec(doc)
+
+	req, res := parseExchange(t,
+		"PUT /users/7 HTTP/1.1\r\nHost: x\r\nContent-Type: application/json\r\nContent-Length: 15\r\n\r\n{\"nick\":\"al\"}\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 16\r\n\r\n{\"age\":\"secret\"}",
+	)
+	go l.handleRequestResponse(req, res, 0, 0)
+	<-l.requestLogs
+
+	vs := l.violations.drain()
+	kinds := map[string]bool{}
+	for _, v := range vs {
+		kinds[v.Kind] = true
+		assert.Equal(t, "/users/{id}", v.Path)
+		assert.NotContains(t, v.Message, "secret")
+	}
+	assert.True(t, kinds[violationMissingRequired], vs)
+	assert.True(t, kinds[violationWrongType], vs)
+
+	text, err := l.encodeMetrics()
+	assert.Nil(t, err)
+	assert.Contains(t, text, `siege_listener_contract_violations_total{kind="wrong_type",method="PUT",path="/users/{id}"} 1`)
+}
+
+func TestValidateUndocumentedStatusAndContentType(t *testing.T) {
+	l, err := NewListener(nil, nil)
+	assert.Nil(t, err)
+
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(validateSpec))
+	assert.Nil(t, err)
+	l.UseSpec(doc)
+
+	req, res := parseExchange(t,
+		"PUT /users/7 HTTP/1.1\r\nHost: x\r\nContent-Type: application/xml\r\nContent-Length: 7\r\n\r\n<a></a>",
+		"HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\n\r\n",
+	)
+	go l.handleRequestResponse(req, res, 0, 0)
+	<-l.requestLogs
+
+	kinds := map[string]bool{}
+	for _, v := range l.violations.drain() {
+		kinds[v.Kind] = true
+	}
+	assert.True(t, kinds[violationUndocumentedStatus])
+	assert.True(t, kinds[violationContentType])
+}
+
+func TestViolationSamplesAreCapped(t *testing.T) {
+	v := newViolations()
+	for i := 0; i < maxViolationSamples*2; i++ {
+		v.record(http.MethodGet, "/", 200, violationInvalid, "")
+	}
+	assert.Len(t, v.drain(), maxViolationSamples)
+	assert.Empty(t, v.drain())
+}
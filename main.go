@@ -2,27 +2,49 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 
 	"github.com/joho/godotenv"
+	"github.com/siegeai/siegelistener/diff"
+	"github.com/siegeai/siegelistener/httpassembly"
+	"github.com/siegeai/siegelistener/infer"
+	"github.com/siegeai/siegelistener/integrations/local"
 	"github.com/siegeai/siegelistener/integrations/siegeserver"
 	"github.com/siegeai/siegelistener/listener"
+	"github.com/siegeai/siegelistener/merge"
+	"github.com/siegeai/siegelistener/pathtemplate"
 )
 
-// TODO We should be able to run / test the listener without access to the server
 // TODO Wire loggers up in a sane way instead of this messy nonsense
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:]))
+	}
+
 	_ = godotenv.Load()
 	apikey := getEnv("SIEGE_APIKEY", "")
 	device := getEnv("SIEGE_DEVICE", "lo")
+	file := getEnv("SIEGE_FILE", "")
 	filter := getEnv("SIEGE_FILTER", "tcp and port 80")
 	server := getEnv("SIEGE_SERVER", "https://dashboard.siegeai.com")
 	level := getEnv("SIEGE_LOG", "info")
+	output := getEnv("SIEGE_OUTPUT", "")
+	descriptors := getEnv("SIEGE_GRPC_DESCRIPTORS", "")
+	keylog := getEnv("SIEGE_KEYLOG", "")
+	trackHeaders := getEnv("SIEGE_TRACK_HEADERS", "") == "true"
+	pathPatterns := getEnv("SIEGE_PATH_PATTERNS", "")
+	spec := getEnv("SIEGE_SPEC", "")
+	numberRange := getEnv("SIEGE_NUMBER_RANGE", "") == "true"
+	integerEnums := getEnv("SIEGE_INTEGER_ENUMS", "") == "true"
+	enumMax := getEnv("SIEGE_ENUM_MAX", "")
 
 	err := setupLogging(level)
 	if err != nil {
@@ -30,29 +52,81 @@ func main() {
 		return
 	}
 
-	if apikey == "" {
-		slog.Error("missing required config option SIEGE_APIKEY")
+	if apikey == "" && output == "" {
+		slog.Error("missing required config option SIEGE_APIKEY (or SIEGE_OUTPUT to run locally)")
 		return
 	}
 
-	source, err := listener.NewPacketSourceLive(device, filter)
+	source, err := newPacketSource(file, device, filter)
 	if err != nil {
 		slog.Error("could not init packet source", "err", err)
 		return
 	}
 
-	client, err := siegeserver.NewClient(apikey, server)
+	publisher, err := newPublisher(output, apikey, server)
 	if err != nil {
-		slog.Error("could not init client", "err", err)
+		slog.Error("could not init publisher", "err", err)
 		return
 	}
 
-	l, err := listener.NewListener(source, client)
+	l, err := listener.NewListener(source, publisher)
 	if err != nil {
 		slog.Error("could not init listener", "err", err)
 		return
 	}
 
+	l.TrackHeaders = trackHeaders
+	infer.TrackNumberRange = numberRange
+	infer.TrackIntegerEnums = integerEnums
+
+	if enumMax != "" {
+		merge.MaxEnumValues, err = strconv.Atoi(enumMax)
+		if err != nil {
+			slog.Error("could not parse SIEGE_ENUM_MAX", "err", err)
+			return
+		}
+	}
+
+	if pathPatterns != "" {
+		// user patterns go first, they know their own api better than our guesses
+		var cs []pathtemplate.Classifier
+		for _, p := range strings.Fields(pathPatterns) {
+			c, err := pathtemplate.NewRegexClassifier(p)
+			if err != nil {
+				slog.Error("could not parse path pattern", "err", err)
+				return
+			}
+			cs = append(cs, c)
+		}
+		l.Templater = pathtemplate.New(append(cs, pathtemplate.DefaultClassifiers()...)...)
+	}
+
+	if spec != "" {
+		doc, err := listener.LoadSpec(spec)
+		if err != nil {
+			slog.Error("could not load spec", "err", err)
+			return
+		}
+		l.UseSpec(doc)
+	}
+
+	if descriptors != "" {
+		l.Descriptors, err = listener.LoadDescriptorSet(descriptors)
+		if err != nil {
+			slog.Error("could not load grpc descriptors", "err", err)
+			return
+		}
+	}
+
+	if keylog != "" {
+		k, err := httpassembly.NewKeyLog(keylog)
+		if err != nil {
+			slog.Error("could not load key log", "err", err)
+			return
+		}
+		l.Assembler.UseKeyLog(k)
+	}
+
 	term := make(chan os.Signal, 1)
 	signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
 
@@ -74,8 +148,59 @@ func main() {
 	go l.PublishJob(ctx, wg)
 	go l.ReassembleJob(ctx, wg)
 
-	slog.Info("listening", "device", device, "filter", filter)
-	<-term
+	if file != "" {
+		slog.Info("replaying", "file", file, "filter", filter)
+	} else {
+		slog.Info("listening", "device", device, "filter", filter)
+	}
+
+	select {
+	case <-term:
+	case <-l.Done():
+		slog.Info("replay complete", "file", file)
+	}
+}
+
+// runDiff compares two spec files and prints what changed, the exit code is 1 when any
+// of it would break clients.
+func runDiff(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: siegelistener diff <old spec> <new spec>")
+		return 2
+	}
+	a, err := diff.LoadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	b, err := diff.LoadFile(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	cs := diff.Docs(a, b)
+	for _, c := range cs {
+		fmt.Println(c)
+	}
+	if len(diff.Breaking(cs)) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func newPacketSource(file, device, filter string) (listener.PacketSource, error) {
+	if file != "" {
+		return listener.NewPacketSourceFile(file, filter)
+	}
+	return listener.NewPacketSourceLive(device, filter)
+}
+
+func newPublisher(output, apikey, server string) (listener.Publisher, error) {
+	if output != "" {
+		return local.NewPublisher(output)
+	}
+	return siegeserver.NewClient(apikey, server)
 }
 
 func setupLogging(level string) error {
@@ -0,0 +1,69 @@
+package merge
+
+import "strings"
+
+// Conflict is something a merge couldn't keep from both sides.
+type Conflict struct {
+	// Path is a JSON pointer to where the sides disagreed, relative to what was merged.
+	Path string
+	Kind string
+	// Kept says which side won, KeptA, KeptB, KeptBoth or KeptNeither.
+	Kept string
+}
+
+const (
+	// ConflictValue is two values where only one could be kept, like two descriptions.
+	ConflictValue = "value"
+	// ConflictType is two different types, the result is a oneOf of them.
+	ConflictType = "type"
+	// ConflictFormat is two formats that disagree, the result has neither.
+	ConflictFormat = "format"
+	// ConflictRef is two different refs, or a ref and an inline value, the result is
+	// the merge of what they point at.
+	ConflictRef = "ref"
+	// ConflictUnresolvedRef is a ref that was never resolved, there's nothing to merge
+	// it with so a is kept.
+	ConflictUnresolvedRef = "unresolved_ref"
+	// ConflictMap is a record merged with a map, its properties become values of the map.
+	ConflictMap = "map"
+)
+
+const (
+	KeptA       = "a"
+	KeptB       = "b"
+	KeptBoth    = "both"
+	KeptNeither = "neither"
+)
+
+// Merger merges OpenAPI documents or any part of one. Merging never fails, when the two
+// sides disagree in a way the result can't represent one of them wins and the Merger
+// records a Conflict. A Merger isn't safe for concurrent use.
+type Merger struct {
+	Conflicts []Conflict
+
+	path []string
+}
+
+// in runs f with the path extended by tokens, conflicts found along the way are
+// reported under it.
+func (m *Merger) in(f func(), tokens ...string) {
+	n := len(m.path)
+	m.path = append(m.path, tokens...)
+	f()
+	m.path = m.path[:n]
+}
+
+func (m *Merger) conflict(kind, kept string, tokens ...string) {
+	m.Conflicts = append(m.Conflicts, Conflict{Path: m.pointer(tokens), Kind: kind, Kept: kept})
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func (m *Merger) pointer(tokens []string) string {
+	var b strings.Builder
+	for _, t := range append(m.path[:len(m.path):len(m.path)], tokens...) {
+		b.WriteString("/")
+		b.WriteString(pointerEscaper.Replace(t))
+	}
+	return b.String()
+}
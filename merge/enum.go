@@ -0,0 +1,217 @@
+package merge
+
+import (
+	"reflect"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Enums are found by tracking the distinct values of each field as samples merge.
+// The values so far and how many samples they came from are kept in extensions, the
+// schema's enum is only filled in once there have been enough samples to believe it.
+const (
+	EnumValuesExtension   = "x-siege-enum-values"
+	ObservationsExtension = "x-siege-observations"
+)
+
+var (
+	// MaxEnumValues is how many distinct values a field can take before we stop
+	// considering it an enum, for good.
+	MaxEnumValues = 16
+	// MinEnumObservations is how many samples a field needs before it's an enum.
+	MinEnumObservations = 5
+)
+
+// NewEnumTracking starts tracking the values of a field from its first sample.
+func NewEnumTracking(v interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		EnumValuesExtension:   []interface{}{v},
+		ObservationsExtension: 1,
+	}
+}
+
+// StopEnumTracking makes sure s is never an enum, e.g. because its value is sensitive.
+// A field with a sample like this can't be an enum either, since merging drops the
+// tracking from any field where one side doesn't have it.
+func StopEnumTracking(s *openapi3.Schema) {
+	if _, in := s.Extensions[EnumValuesExtension]; !in {
+		return
+	}
+	ext := make(map[string]interface{}, len(s.Extensions))
+	for k, v := range s.Extensions {
+		if k != EnumValuesExtension && k != ObservationsExtension {
+			ext[k] = v
+		}
+	}
+	if len(ext) == 0 {
+		ext = nil
+	}
+	s.Extensions = ext
+	s.Enum = nil
+}
+
+// mergeEnumTracking sets the enum of s, the merge of a and b. Enums that weren't
+// tracked, like those from a protobuf descriptor, are just unioned.
+func mergeEnumTracking(s, a, b *openapi3.Schema) {
+	av, aTracked := enumValues(a)
+	bv, bTracked := enumValues(b)
+	if !aTracked && !bTracked {
+		s.Enum = mergeEnum(a.Enum, b.Enum)
+		return
+	}
+
+	ext := make(map[string]interface{}, len(s.Extensions)+2)
+	for k, v := range s.Extensions {
+		if k != EnumValuesExtension && k != ObservationsExtension {
+			ext[k] = v
+		}
+	}
+	s.Extensions = ext
+
+	vs := mergeEnum(av, bv)
+	if vs == nil {
+		// demoted, nothing more to track
+		s.Enum = nil
+		if len(ext) == 0 {
+			s.Extensions = nil
+		}
+		return
+	}
+
+	n := observations(a) + observations(b)
+	ext[EnumValuesExtension] = vs
+	ext[ObservationsExtension] = n
+	if n >= MinEnumObservations {
+		s.Enum = vs
+	}
+}
+
+func enumValues(s *openapi3.Schema) ([]interface{}, bool) {
+	vs, in := s.Extensions[EnumValuesExtension]
+	if !in {
+		return nil, false
+	}
+	res, _ := vs.([]interface{})
+	return res, true
+}
+
+func observations(s *openapi3.Schema) int {
+	// a document that has been through json has float64s here
+	switch n := s.Extensions[ObservationsExtension].(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// mergeEnum unions both sides' values. A side without an enum can be anything, so
+// once one side has none, neither does the result.
+func mergeEnum(a, b []interface{}) []interface{} {
+	if a == nil || b == nil {
+		return nil
+	}
+
+	res := append([]interface{}{}, a...)
+	for _, v := range b {
+		if !containsValue(res, v) {
+			res = append(res, v)
+		}
+	}
+	if len(res) > MaxEnumValues {
+		return nil
+	}
+	return res
+}
+
+func containsValue(vs []interface{}, v interface{}) bool {
+	for _, u := range vs {
+		if reflect.DeepEqual(u, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrackingExtension reports whether k is bookkeeping for enum tracking rather than
+// something the document says, those are merged by mergeEnumTracking.
+func isTrackingExtension(k string) bool {
+	return k == EnumValuesExtension || k == ObservationsExtension
+}
+
+// ObserveEnums counts sample towards the enums doc is tracking, for samples whose
+// shape has been merged into doc already and only have their values to add. It
+// reports whether any of doc's enums changed.
+func ObserveEnums(doc, sample openapi3.Paths) bool {
+	changed := false
+	for path, item := range sample {
+		d := doc[path]
+		if d == nil {
+			continue
+		}
+		for method, op := range item.Operations() {
+			dop := d.GetOperation(method)
+			if dop == nil {
+				continue
+			}
+			for _, p := range op.Parameters {
+				if p.Value == nil {
+					continue
+				}
+				if dp := dop.Parameters.GetByInAndName(p.Value.In, p.Value.Name); dp != nil {
+					changed = observeSchemaRef(dp.Schema, p.Value.Schema) || changed
+				}
+			}
+			if op.RequestBody != nil && op.RequestBody.Value != nil && dop.RequestBody != nil && dop.RequestBody.Value != nil {
+				changed = observeContent(dop.RequestBody.Value.Content, op.RequestBody.Value.Content) || changed
+			}
+			for status, r := range op.Responses {
+				dr := dop.Responses[status]
+				if r.Value == nil || dr == nil || dr.Value == nil {
+					continue
+				}
+				changed = observeContent(dr.Value.Content, r.Value.Content) || changed
+				for name, h := range r.Value.Headers {
+					if dh := dr.Value.Headers[name]; h.Value != nil && dh != nil && dh.Value != nil {
+						changed = observeSchemaRef(dh.Value.Schema, h.Value.Schema) || changed
+					}
+				}
+			}
+		}
+	}
+	return changed
+}
+
+func observeContent(doc, sample openapi3.Content) bool {
+	changed := false
+	for k, mt := range sample {
+		if dmt := doc[k]; dmt != nil {
+			changed = observeSchemaRef(dmt.Schema, mt.Schema) || changed
+		}
+	}
+	return changed
+}
+
+func observeSchemaRef(doc, sample *openapi3.SchemaRef) bool {
+	if doc == nil || sample == nil || doc.Value == nil || sample.Value == nil {
+		return false
+	}
+	d, s := doc.Value, sample.Value
+
+	// a field doc isn't tracking has been demoted or never was a candidate
+	changed := false
+	_, dTracked := d.Extensions[EnumValuesExtension]
+	_, sTracked := s.Extensions[EnumValuesExtension]
+	if dTracked && sTracked {
+		before := *d
+		mergeEnumTracking(d, &before, s)
+		changed = !reflect.DeepEqual(before.Enum, d.Enum)
+	}
+	for k, p := range s.Properties {
+		changed = observeSchemaRef(d.Properties[k], p) || changed
+	}
+	changed = observeSchemaRef(d.Items, s.Items) || changed
+	changed = observeSchemaRef(d.AdditionalProperties.Schema, s.AdditionalProperties.Schema) || changed
+	return changed
+}
@@ -0,0 +1,45 @@
+package merge
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// An object is either a record, with properties, or a map, with additionalProperties
+// describing every value. Once either side is a map the merge is one too, the record's
+// properties were just the keys that side happened to see.
+
+// mergeMapProperties sets the properties of s, the merge of a and b, when either of
+// them is a map.
+func (m *Merger) mergeMapProperties(s, a, b *openapi3.Schema) {
+	s.AdditionalProperties.Has = mergeBoolPtr(a.AdditionalProperties.Has, b.AdditionalProperties.Has)
+	if !isMap(a) && !isMap(b) {
+		return
+	}
+
+	if isMap(a) && isMap(b) {
+		if len(a.Properties) != 0 || len(b.Properties) != 0 {
+			m.conflict(ConflictMap, KeptBoth, "properties")
+		}
+	} else if isMap(a) && len(b.Properties) != 0 {
+		m.conflict(ConflictMap, KeptA, "properties")
+	} else if isMap(b) && len(a.Properties) != 0 {
+		m.conflict(ConflictMap, KeptB, "properties")
+	}
+
+	m.in(func() {
+		value := m.SchemaRef(a.AdditionalProperties.Schema, b.AdditionalProperties.Schema)
+		for _, props := range []openapi3.Schemas{a.Properties, b.Properties} {
+			for _, k := range sortedKeys(props) {
+				value = m.SchemaRef(value, props[k])
+			}
+		}
+		s.AdditionalProperties.Schema = value
+	}, "additionalProperties")
+
+	s.Properties = nil
+	s.Required = nil
+}
+
+func isMap(s *openapi3.Schema) bool {
+	return s.AdditionalProperties.Schema != nil
+}
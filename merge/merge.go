@@ -1,11 +1,18 @@
 package merge
 
-import "github.com/getkin/kin-openapi/openapi3"
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
 
 // TODO this representation kind of sucks. Would be nice to have an interface based
 //   representation that could be backed by either a json doc or a dense tree.
 
-func Doc(a, b *openapi3.T) *openapi3.T {
+func (m *Merger) Doc(a, b *openapi3.T) *openapi3.T {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -16,30 +23,43 @@ func Doc(a, b *openapi3.T) *openapi3.T {
 		return b
 	}
 
-	return &openapi3.T{
-		Extensions:   Extensions(a.Extensions, b.Extensions),
-		OpenAPI:      OpenAPI(a.OpenAPI, b.OpenAPI),
-		Components:   Components(a.Components, b.Components),
-		Info:         Info(a.Info, b.Info),
-		Paths:        Paths(a.Paths, b.Paths),
-		Security:     *Security(&a.Security, &b.Security),
-		Servers:      *Servers(&a.Servers, &b.Servers),
-		Tags:         Tags(a.Tags, b.Tags),
-		ExternalDocs: ExternalDocs(a.ExternalDocs, b.ExternalDocs),
+	res := &openapi3.T{
+		Extensions: m.Extensions(a.Extensions, b.Extensions),
+		OpenAPI:    m.mergeString("openapi", a.OpenAPI, b.OpenAPI),
 	}
+	m.in(func() { res.Components = m.Components(a.Components, b.Components) }, "components")
+	m.in(func() { res.Info = m.Info(a.Info, b.Info) }, "info")
+	m.in(func() { res.Paths = m.Paths(a.Paths, b.Paths) }, "paths")
+	res.Security = *m.Security(&a.Security, &b.Security)
+	m.in(func() { res.Servers = *m.Servers(&a.Servers, &b.Servers) }, "servers")
+	m.in(func() { res.Tags = m.Tags(a.Tags, b.Tags) }, "tags")
+	m.in(func() { res.ExternalDocs = m.ExternalDocs(a.ExternalDocs, b.ExternalDocs) }, "externalDocs")
+	return res
 }
 
-func Extensions(a, b map[string]interface{}) map[string]interface{} {
-	// merging interface{} is gross
-	// TODO
-	return a
-}
+func (m *Merger) Extensions(a, b map[string]interface{}) map[string]interface{} {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
 
-func OpenAPI(a, b string) string {
-	return mergeString(a, b)
+	// merging interface{} is gross, a wins where both have the same extension
+	c := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range b {
+		c[k] = v
+	}
+	for _, k := range sortedKeys(a) {
+		if w, in := b[k]; in && !reflect.DeepEqual(a[k], w) && !isTrackingExtension(k) {
+			m.conflict(ConflictValue, KeptA, k)
+		}
+		c[k] = a[k]
+	}
+	return c
 }
 
-func Components(a, b *openapi3.Components) *openapi3.Components {
+func (m *Merger) Components(a, b *openapi3.Components) *openapi3.Components {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -50,11 +70,93 @@ func Components(a, b *openapi3.Components) *openapi3.Components {
 		return b
 	}
 
-	// TODO
-	return a
+	res := &openapi3.Components{Extensions: m.Extensions(a.Extensions, b.Extensions)}
+	m.in(func() { res.Schemas = m.Schemas(a.Schemas, b.Schemas) }, "schemas")
+	m.in(func() { res.Parameters = m.ParametersMap(a.Parameters, b.Parameters) }, "parameters")
+	m.in(func() { res.Headers = m.Headers(a.Headers, b.Headers) }, "headers")
+	m.in(func() { res.RequestBodies = m.RequestBodies(a.RequestBodies, b.RequestBodies) }, "requestBodies")
+	m.in(func() { res.Responses = m.Responses(a.Responses, b.Responses) }, "responses")
+	m.in(func() { res.SecuritySchemes = m.SecuritySchemes(a.SecuritySchemes, b.SecuritySchemes) }, "securitySchemes")
+	m.in(func() { res.Examples = m.Examples(a.Examples, b.Examples) }, "examples")
+	m.in(func() { res.Links = m.Links(a.Links, b.Links) }, "links")
+	m.in(func() { res.Callbacks = m.Callbacks(a.Callbacks, b.Callbacks) }, "callbacks")
+	return res
+}
+
+// ParametersMap merges named parameters, like those under components.
+func (m *Merger) ParametersMap(a, b openapi3.ParametersMap) openapi3.ParametersMap {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	if len(a) == 0 && len(b) != 0 {
+		return b
+	}
+	if len(a) != 0 && len(b) == 0 {
+		return a
+	}
+
+	rs := make(openapi3.ParametersMap, max(len(a), len(b)))
+	for _, k := range sortedKeys(a) {
+		m.in(func() { rs[k] = m.ParameterRef(a[k], b[k]) }, k)
+	}
+	for k, v := range b {
+		if _, in := rs[k]; !in {
+			rs[k] = v
+		}
+	}
+	return rs
 }
 
-func Info(a, b *openapi3.Info) *openapi3.Info {
+func (m *Merger) RequestBodies(a, b openapi3.RequestBodies) openapi3.RequestBodies {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	if len(a) == 0 && len(b) != 0 {
+		return b
+	}
+	if len(a) != 0 && len(b) == 0 {
+		return a
+	}
+
+	rs := make(openapi3.RequestBodies, max(len(a), len(b)))
+	for _, k := range sortedKeys(a) {
+		m.in(func() { rs[k] = m.RequestBodyRef(a[k], b[k]) }, k)
+	}
+	for k, v := range b {
+		if _, in := rs[k]; !in {
+			rs[k] = v
+		}
+	}
+	return rs
+}
+
+// SecuritySchemes keeps every scheme, a describes the same scheme better than we can
+// merge it.
+func (m *Merger) SecuritySchemes(a, b openapi3.SecuritySchemes) openapi3.SecuritySchemes {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	if len(a) == 0 && len(b) != 0 {
+		return b
+	}
+	if len(a) != 0 && len(b) == 0 {
+		return a
+	}
+
+	rs := make(openapi3.SecuritySchemes, max(len(a), len(b)))
+	for k, v := range b {
+		rs[k] = v
+	}
+	for _, k := range sortedKeys(a) {
+		if w, in := b[k]; in && !reflect.DeepEqual(a[k], w) {
+			m.conflict(ConflictValue, KeptA, k)
+		}
+		rs[k] = a[k]
+	}
+	return rs
+}
+
+func (m *Merger) Info(a, b *openapi3.Info) *openapi3.Info {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -65,20 +167,35 @@ func Info(a, b *openapi3.Info) *openapi3.Info {
 		return b
 	}
 
-	// TODO
-	return a
+	// contact and license aren't something traffic tells us about, keep the first
+	contact, license := a.Contact, a.License
+	if contact == nil {
+		contact = b.Contact
+	}
+	if license == nil {
+		license = b.License
+	}
+	return &openapi3.Info{
+		Extensions:     m.Extensions(a.Extensions, b.Extensions),
+		Title:          m.mergeString("title", a.Title, b.Title),
+		Description:    m.mergeString("description", a.Description, b.Description),
+		TermsOfService: m.mergeString("termsOfService", a.TermsOfService, b.TermsOfService),
+		Contact:        contact,
+		License:        license,
+		Version:        m.mergeString("version", a.Version, b.Version),
+	}
 }
 
-func Paths(a, b openapi3.Paths) openapi3.Paths {
+func (m *Merger) Paths(a, b openapi3.Paths) openapi3.Paths {
 	res := make(openapi3.Paths, len(a))
 
 	visited := make(map[string]struct{}, len(a))
-	for k, v := range a {
+	for _, k := range sortedKeys(a) {
 		visited[k] = struct{}{}
 		if w, in := b[k]; in {
-			res[k] = PathItem(v, w)
+			m.in(func() { res[k] = m.PathItem(a[k], w) }, k)
 		} else {
-			res[k] = v
+			res[k] = a[k]
 		}
 	}
 
@@ -92,7 +209,7 @@ func Paths(a, b openapi3.Paths) openapi3.Paths {
 	return res
 }
 
-func PathItem(a, b *openapi3.PathItem) *openapi3.PathItem {
+func (m *Merger) PathItem(a, b *openapi3.PathItem) *openapi3.PathItem {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -104,37 +221,83 @@ func PathItem(a, b *openapi3.PathItem) *openapi3.PathItem {
 	}
 
 	// TODO needs a branch to handle the $ref?
-	return &openapi3.PathItem{
-		Ref:         Ref(a.Ref, b.Ref),
-		Summary:     Summary(a.Summary, b.Summary),
-		Description: Description(a.Description, b.Description),
-		Connect:     Operation(a.Connect, b.Connect),
-		Delete:      Operation(a.Delete, b.Delete),
-		Get:         Operation(a.Get, b.Get),
-		Head:        Operation(a.Head, b.Head),
-		Options:     Operation(a.Options, b.Options),
-		Patch:       Operation(a.Patch, b.Patch),
-		Post:        Operation(a.Post, b.Post),
-		Put:         Operation(a.Put, b.Put),
-		Trace:       Operation(a.Trace, b.Trace),
-		Servers:     *Servers(&a.Servers, &b.Servers),
-		Parameters:  Parameters(a.Parameters, b.Parameters),
-	}
+	res := &openapi3.PathItem{
+		Extensions:  m.Extensions(a.Extensions, b.Extensions),
+		Ref:         m.mergeString("$ref", a.Ref, b.Ref),
+		Summary:     m.mergeString("summary", a.Summary, b.Summary),
+		Description: m.mergeString("description", a.Description, b.Description),
+	}
+	m.in(func() { res.Connect = m.Operation(a.Connect, b.Connect) }, "connect")
+	m.in(func() { res.Delete = m.Operation(a.Delete, b.Delete) }, "delete")
+	m.in(func() { res.Get = m.Operation(a.Get, b.Get) }, "get")
+	m.in(func() { res.Head = m.Operation(a.Head, b.Head) }, "head")
+	m.in(func() { res.Options = m.Operation(a.Options, b.Options) }, "options")
+	m.in(func() { res.Patch = m.Operation(a.Patch, b.Patch) }, "patch")
+	m.in(func() { res.Post = m.Operation(a.Post, b.Post) }, "post")
+	m.in(func() { res.Put = m.Operation(a.Put, b.Put) }, "put")
+	m.in(func() { res.Trace = m.Operation(a.Trace, b.Trace) }, "trace")
+	m.in(func() { res.Servers = *m.Servers(&a.Servers, &b.Servers) }, "servers")
+	m.in(func() { res.Parameters = m.Parameters(a.Parameters, b.Parameters) }, "parameters")
+	return res
 }
 
-func Ref(a, b string) string {
-	return mergeString(a, b)
+func (m *Merger) Operation(a, b *openapi3.Operation) *openapi3.Operation {
+	if a == nil && b == nil {
+		return nil
+	}
+	if a != nil && b == nil {
+		return a
+	}
+	if a == nil && b != nil {
+		return b
+	}
+
+	res := &openapi3.Operation{
+		Extensions:  m.Extensions(a.Extensions, b.Extensions),
+		Tags:        operationTags(a.Tags, b.Tags), // different kind of tags
+		Summary:     m.mergeString("summary", a.Summary, b.Summary),
+		Description: m.mergeString("description", a.Description, b.Description),
+		OperationID: m.mergeString("operationId", a.OperationID, b.OperationID),
+		Deprecated:  a.Deprecated || b.Deprecated,
+		Security:    m.Security(a.Security, b.Security),
+	}
+	m.in(func() { res.Parameters = m.Parameters(a.Parameters, b.Parameters) }, "parameters")
+	m.in(func() { res.RequestBody = m.RequestBodyRef(a.RequestBody, b.RequestBody) }, "requestBody")
+	m.in(func() { res.Responses = m.Responses(a.Responses, b.Responses) }, "responses")
+	m.in(func() { res.Callbacks = m.Callbacks(a.Callbacks, b.Callbacks) }, "callbacks")
+	m.in(func() { res.Servers = m.Servers(a.Servers, b.Servers) }, "servers")
+	m.in(func() { res.ExternalDocs = m.ExternalDocs(a.ExternalDocs, b.ExternalDocs) }, "externalDocs")
+	return res
 }
 
-func Summary(a, b string) string {
-	return mergeString(a, b)
+// operationTags keeps every tag either side was filed under, in order.
+func operationTags(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	if len(a) == 0 {
+		return b
+	}
+
+	res := append([]string{}, a...)
+	for _, t := range b {
+		if !containsString(res, t) {
+			res = append(res, t)
+		}
+	}
+	return res
 }
 
-func Description(a, b string) string {
-	return mergeString(a, b)
+func containsString(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
 }
 
-func Operation(a, b *openapi3.Operation) *openapi3.Operation {
+func (m *Merger) RequestBodyRef(a, b *openapi3.RequestBodyRef) *openapi3.RequestBodyRef {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -144,33 +307,31 @@ func Operation(a, b *openapi3.Operation) *openapi3.Operation {
 	if a == nil && b != nil {
 		return b
 	}
-
-	return &openapi3.Operation{
-		Extensions:   Extensions(a.Extensions, b.Extensions),
-		Tags:         operationTags(a.Tags, b.Tags), // different kind of tags
-		Summary:      Summary(a.Summary, b.Summary),
-		Description:  Description(a.Description, b.Description),
-		OperationID:  operationID(a.OperationID, b.OperationID),
-		Parameters:   Parameters(a.Parameters, b.Parameters),
-		RequestBody:  RequestBodyRef(a.RequestBody, b.RequestBody),
-		Responses:    Responses(a.Responses, b.Responses),
-		Callbacks:    Callbacks(a.Callbacks, b.Callbacks),
-		Deprecated:   deprecated(a.Deprecated, b.Deprecated),
-		Security:     Security(a.Security, b.Security),
-		Servers:      Servers(a.Servers, b.Servers),
-		ExternalDocs: ExternalDocs(a.ExternalDocs, b.ExternalDocs),
+	if !m.resolvable(a.Ref, b.Ref, a.Value != nil, b.Value != nil) {
+		return a
 	}
-}
 
-func operationID(a, b string) string {
-	return mergeString(a, b)
+	return &openapi3.RequestBodyRef{Value: m.RequestBody(a.Value, b.Value)}
 }
 
-func operationTags(a, b []string) []string {
-	return a
+// resolvable reports whether two refs should be merged by what they point at. Two
+// pointing at the same component don't need to be, that's merged along with the rest
+// of the components, and a ref that was never resolved leaves nothing to merge.
+func (m *Merger) resolvable(aRef, bRef string, aValue, bValue bool) bool {
+	if aRef != "" && aRef == bRef {
+		return false
+	}
+	if !aValue || !bValue {
+		m.conflict(ConflictUnresolvedRef, KeptA)
+		return false
+	}
+	if aRef != "" || bRef != "" {
+		m.conflict(ConflictRef, KeptBoth)
+	}
+	return true
 }
 
-func RequestBodyRef(a, b *openapi3.RequestBodyRef) *openapi3.RequestBodyRef {
+func (m *Merger) RequestBody(a, b *openapi3.RequestBody) *openapi3.RequestBody {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -180,26 +341,17 @@ func RequestBodyRef(a, b *openapi3.RequestBodyRef) *openapi3.RequestBodyRef {
 	if a == nil && b != nil {
 		return b
 	}
-	if a.Ref != "" || b.Ref != "" {
-		panic("need to handle this case")
-	}
-	if a.Value == nil || b.Value == nil {
-		panic("need to handle this case")
-	}
 
-	return &openapi3.RequestBodyRef{Value: RequestBody(a.Value, b.Value)}
-}
-
-func RequestBody(a, b *openapi3.RequestBody) *openapi3.RequestBody {
-	return &openapi3.RequestBody{
-		Extensions:  Extensions(a.Extensions, b.Extensions),
-		Description: Description(a.Description, b.Description),
+	res := &openapi3.RequestBody{
+		Extensions:  m.Extensions(a.Extensions, b.Extensions),
+		Description: m.mergeString("description", a.Description, b.Description),
 		Required:    a.Required || b.Required,
-		Content:     Content(a.Content, b.Content),
 	}
+	m.in(func() { res.Content = m.Content(a.Content, b.Content) }, "content")
+	return res
 }
 
-func Content(a, b openapi3.Content) openapi3.Content {
+func (m *Merger) Content(a, b openapi3.Content) openapi3.Content {
 	if len(a) == 0 && len(b) == 0 {
 		return openapi3.Content{}
 	}
@@ -213,12 +365,12 @@ func Content(a, b openapi3.Content) openapi3.Content {
 	c := make(openapi3.Content, max(len(a), len(b)))
 
 	visited := make(map[string]struct{}, len(a))
-	for k, v := range a {
+	for _, k := range sortedKeys(a) {
 		visited[k] = struct{}{}
 		if w, in := b[k]; in {
-			c[k] = MediaType(v, w)
+			m.in(func() { c[k] = m.MediaType(a[k], w) }, k)
 		} else {
-			c[k] = v
+			c[k] = a[k]
 		}
 	}
 
@@ -232,7 +384,7 @@ func Content(a, b openapi3.Content) openapi3.Content {
 	return c
 }
 
-func MediaType(a, b *openapi3.MediaType) *openapi3.MediaType {
+func (m *Merger) MediaType(a, b *openapi3.MediaType) *openapi3.MediaType {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -243,31 +395,99 @@ func MediaType(a, b *openapi3.MediaType) *openapi3.MediaType {
 		return b
 	}
 
-	return &openapi3.MediaType{
-		Extensions: Extensions(a.Extensions, b.Extensions),
-		Schema:     SchemaRef(a.Schema, b.Schema),
-		Example:    Example(a.Example, b.Example),
-		Examples:   Examples(a.Examples, b.Examples),
-		Encoding:   Encoding(a.Encoding, b.Encoding),
+	res := &openapi3.MediaType{
+		Extensions: m.Extensions(a.Extensions, b.Extensions),
+		Example:    m.Example(a.Example, b.Example),
 	}
+	m.in(func() { res.Schema = m.SchemaRef(a.Schema, b.Schema) }, "schema")
+	m.in(func() { res.Examples = m.Examples(a.Examples, b.Examples) }, "examples")
+	m.in(func() { res.Encoding = m.Encodings(a.Encoding, b.Encoding) }, "encoding")
+	return res
 }
 
-func Example(a, b interface{}) interface{} {
-	// TODO
+// Example keeps one of the examples, a if there is one.
+func (m *Merger) Example(a, b interface{}) interface{} {
+	if a == nil {
+		return b
+	}
+	if b != nil && !reflect.DeepEqual(a, b) {
+		m.conflict(ConflictValue, KeptA, "example")
+	}
 	return a
 }
 
-func Examples(a, b openapi3.Examples) openapi3.Examples {
-	// TODO
-	return a
+// Examples keeps every named example, a's where both have one by the same name.
+func (m *Merger) Examples(a, b openapi3.Examples) openapi3.Examples {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	if len(a) == 0 && len(b) != 0 {
+		return b
+	}
+	if len(a) != 0 && len(b) == 0 {
+		return a
+	}
+
+	rs := make(openapi3.Examples, max(len(a), len(b)))
+	for k, v := range b {
+		rs[k] = v
+	}
+	for _, k := range sortedKeys(a) {
+		if w, in := b[k]; in && !reflect.DeepEqual(a[k], w) {
+			m.conflict(ConflictValue, KeptA, k)
+		}
+		rs[k] = a[k]
+	}
+	return rs
 }
 
-func Encoding(a, b map[string]*openapi3.Encoding) map[string]*openapi3.Encoding {
-	// TODO
-	return a
+func (m *Merger) Encodings(a, b map[string]*openapi3.Encoding) map[string]*openapi3.Encoding {
+	if a == nil && b == nil {
+		return nil
+	}
+	if a != nil && b == nil {
+		return a
+	}
+	if a == nil && b != nil {
+		return b
+	}
+
+	c := make(map[string]*openapi3.Encoding, max(len(a), len(b)))
+	for k, v := range b {
+		c[k] = v
+	}
+	for _, k := range sortedKeys(a) {
+		m.in(func() { c[k] = m.Encoding(a[k], b[k]) }, k)
+	}
+	return c
 }
 
-func Responses(a, b openapi3.Responses) openapi3.Responses {
+func (m *Merger) Encoding(a, b *openapi3.Encoding) *openapi3.Encoding {
+	if a == nil && b == nil {
+		return nil
+	}
+	if a != nil && b == nil {
+		return a
+	}
+	if a == nil && b != nil {
+		return b
+	}
+
+	res := &openapi3.Encoding{
+		Extensions:    m.Extensions(a.Extensions, b.Extensions),
+		ContentType:   m.mergeString("contentType", a.ContentType, b.ContentType),
+		Style:         m.mergeString("style", a.Style, b.Style),
+		Explode:       mergeBoolPtr(a.Explode, b.Explode),
+		AllowReserved: a.AllowReserved || b.AllowReserved,
+	}
+	m.in(func() { res.Headers = m.Headers(a.Headers, b.Headers) }, "headers")
+	if len(res.Headers) == 0 {
+		res.Headers = nil
+	}
+	return res
+}
+
+func (m *Merger) Responses(a, b openapi3.Responses) openapi3.Responses {
 	if len(a) == 0 && len(b) == 0 {
 		return openapi3.Responses{}
 	}
@@ -281,12 +501,12 @@ func Responses(a, b openapi3.Responses) openapi3.Responses {
 	rs := make(openapi3.Responses, max(len(a), len(b)))
 
 	visited := make(map[string]struct{}, len(a))
-	for k, v := range a {
+	for _, k := range sortedKeys(a) {
 		visited[k] = struct{}{}
 		if w, in := b[k]; in {
-			rs[k] = ResponseRef(v, w)
+			m.in(func() { rs[k] = m.ResponseRef(a[k], w) }, k)
 		} else {
-			rs[k] = v
+			rs[k] = a[k]
 		}
 	}
 
@@ -300,7 +520,7 @@ func Responses(a, b openapi3.Responses) openapi3.Responses {
 	return rs
 }
 
-func ResponseRef(a, b *openapi3.ResponseRef) *openapi3.ResponseRef {
+func (m *Merger) ResponseRef(a, b *openapi3.ResponseRef) *openapi3.ResponseRef {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -310,17 +530,14 @@ func ResponseRef(a, b *openapi3.ResponseRef) *openapi3.ResponseRef {
 	if a == nil && b != nil {
 		return b
 	}
-	if a.Ref != "" || b.Ref != "" {
-		panic("need to handle this case")
-	}
-	if a.Value == nil || b.Value == nil {
-		panic("need to handle this case")
+	if !m.resolvable(a.Ref, b.Ref, a.Value != nil, b.Value != nil) {
+		return a
 	}
 
-	return &openapi3.ResponseRef{Value: Response(a.Value, b.Value)}
+	return &openapi3.ResponseRef{Value: m.Response(a.Value, b.Value)}
 }
 
-func Response(a, b *openapi3.Response) *openapi3.Response {
+func (m *Merger) Response(a, b *openapi3.Response) *openapi3.Response {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -331,17 +548,17 @@ func Response(a, b *openapi3.Response) *openapi3.Response {
 		return b
 	}
 
-	dsc := mergeStringPtr(a.Description, b.Description)
-	return &openapi3.Response{
-		Extensions:  Extensions(a.Extensions, b.Extensions),
-		Description: dsc,
-		Headers:     Headers(a.Headers, b.Headers),
-		Content:     Content(a.Content, b.Content),
-		Links:       Links(a.Links, b.Links),
+	res := &openapi3.Response{
+		Extensions:  m.Extensions(a.Extensions, b.Extensions),
+		Description: m.mergeStringPtr("description", a.Description, b.Description),
 	}
+	m.in(func() { res.Headers = m.Headers(a.Headers, b.Headers) }, "headers")
+	m.in(func() { res.Content = m.Content(a.Content, b.Content) }, "content")
+	m.in(func() { res.Links = m.Links(a.Links, b.Links) }, "links")
+	return res
 }
 
-func mergeStringPtr(a, b *string) *string {
+func (m *Merger) mergeStringPtr(field string, a, b *string) *string {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -352,11 +569,11 @@ func mergeStringPtr(a, b *string) *string {
 		return b
 	}
 
-	s := mergeString(*a, *b)
+	s := m.mergeString(field, *a, *b)
 	return &s
 }
 
-func Headers(a, b map[string]*openapi3.HeaderRef) map[string]*openapi3.HeaderRef {
+func (m *Merger) Headers(a, b map[string]*openapi3.HeaderRef) map[string]*openapi3.HeaderRef {
 	if len(a) == 0 && len(b) == 0 {
 		return map[string]*openapi3.HeaderRef{}
 	}
@@ -370,12 +587,12 @@ func Headers(a, b map[string]*openapi3.HeaderRef) map[string]*openapi3.HeaderRef
 	rs := make(map[string]*openapi3.HeaderRef, max(len(a), len(b)))
 
 	visited := make(map[string]struct{}, len(a))
-	for k, v := range a {
+	for _, k := range sortedKeys(a) {
 		visited[k] = struct{}{}
 		if w, in := b[k]; in {
-			rs[k] = HeaderRef(v, w)
+			m.in(func() { rs[k] = m.HeaderRef(a[k], w) }, k)
 		} else {
-			rs[k] = v
+			rs[k] = a[k]
 		}
 	}
 
@@ -389,7 +606,7 @@ func Headers(a, b map[string]*openapi3.HeaderRef) map[string]*openapi3.HeaderRef
 	return rs
 }
 
-func HeaderRef(a, b *openapi3.HeaderRef) *openapi3.HeaderRef {
+func (m *Merger) HeaderRef(a, b *openapi3.HeaderRef) *openapi3.HeaderRef {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -399,17 +616,14 @@ func HeaderRef(a, b *openapi3.HeaderRef) *openapi3.HeaderRef {
 	if a == nil && b != nil {
 		return b
 	}
-	if a.Ref != "" || b.Ref != "" {
-		panic("need to handle this case")
-	}
-	if a.Value == nil || b.Value == nil {
-		panic("need to handle this case")
+	if !m.resolvable(a.Ref, b.Ref, a.Value != nil, b.Value != nil) {
+		return a
 	}
 
-	return &openapi3.HeaderRef{Value: Header(a.Value, b.Value)}
+	return &openapi3.HeaderRef{Value: m.Header(a.Value, b.Value)}
 }
 
-func Header(a, b *openapi3.Header) *openapi3.Header {
+func (m *Merger) Header(a, b *openapi3.Header) *openapi3.Header {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -421,11 +635,11 @@ func Header(a, b *openapi3.Header) *openapi3.Header {
 	}
 
 	return &openapi3.Header{
-		Parameter: *Parameter(&a.Parameter, &b.Parameter),
+		Parameter: *m.Parameter(&a.Parameter, &b.Parameter),
 	}
 }
 
-func Parameter(a, b *openapi3.Parameter) *openapi3.Parameter {
+func (m *Merger) Parameter(a, b *openapi3.Parameter) *openapi3.Parameter {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -436,26 +650,43 @@ func Parameter(a, b *openapi3.Parameter) *openapi3.Parameter {
 		return b
 	}
 
-	// TODO AHHH how much of this bs is there
-	return &openapi3.Parameter{
-		Extensions:      Extensions(a.Extensions, b.Extensions),
-		Name:            mergeString(a.Name, b.Name),
-		In:              mergeString(a.In, b.In),
-		Description:     Description(a.Description, b.Description),
-		Style:           mergeString(a.Style, b.Style),
-		Explode:         nil,
-		AllowEmptyValue: false,
-		AllowReserved:   false,
-		Deprecated:      false,
-		Required:        false,
-		Schema:          nil,
-		Example:         nil,
-		Examples:        nil,
-		Content:         nil,
+	res := &openapi3.Parameter{
+		Extensions:      m.Extensions(a.Extensions, b.Extensions),
+		Name:            m.mergeString("name", a.Name, b.Name),
+		In:              m.mergeString("in", a.In, b.In),
+		Description:     m.mergeString("description", a.Description, b.Description),
+		Style:           m.mergeString("style", a.Style, b.Style),
+		Explode:         mergeBoolPtr(a.Explode, b.Explode),
+		AllowEmptyValue: a.AllowEmptyValue || b.AllowEmptyValue,
+		AllowReserved:   a.AllowReserved || b.AllowReserved,
+		Deprecated:      a.Deprecated || b.Deprecated,
+		Required:        a.Required && b.Required,
+		Example:         m.Example(a.Example, b.Example),
+	}
+	m.in(func() { res.Schema = m.SchemaRef(a.Schema, b.Schema) }, "schema")
+	m.in(func() { res.Examples = m.Examples(a.Examples, b.Examples) }, "examples")
+	if res.Schema != nil && res.Schema.Value != nil && isPII(res.Schema.Value) {
+		res.Example = nil
+		res.Examples = nil
+	}
+	if len(a.Content) != 0 || len(b.Content) != 0 {
+		m.in(func() { res.Content = m.Content(a.Content, b.Content) }, "content")
 	}
+	return res
 }
 
-func Links(a, b openapi3.Links) openapi3.Links {
+func mergeBoolPtr(a, b *bool) *bool {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	v := *a || *b
+	return &v
+}
+
+func (m *Merger) Links(a, b openapi3.Links) openapi3.Links {
 	if len(a) == 0 && len(b) == 0 {
 		return openapi3.Links{}
 	}
@@ -469,12 +700,12 @@ func Links(a, b openapi3.Links) openapi3.Links {
 	rs := make(openapi3.Links, max(len(a), len(b)))
 
 	visited := make(map[string]struct{}, len(a))
-	for k, v := range a {
+	for _, k := range sortedKeys(a) {
 		visited[k] = struct{}{}
 		if w, in := b[k]; in {
-			rs[k] = LinkRef(v, w)
+			m.in(func() { rs[k] = m.LinkRef(a[k], w) }, k)
 		} else {
-			rs[k] = v
+			rs[k] = a[k]
 		}
 	}
 
@@ -488,7 +719,7 @@ func Links(a, b openapi3.Links) openapi3.Links {
 	return rs
 }
 
-func LinkRef(a, b *openapi3.LinkRef) *openapi3.LinkRef {
+func (m *Merger) LinkRef(a, b *openapi3.LinkRef) *openapi3.LinkRef {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -498,17 +729,14 @@ func LinkRef(a, b *openapi3.LinkRef) *openapi3.LinkRef {
 	if a == nil && b != nil {
 		return b
 	}
-	if a.Ref != "" || b.Ref != "" {
-		panic("need to handle this case")
-	}
-	if a.Value == nil || b.Value == nil {
-		panic("need to handle this case")
+	if !m.resolvable(a.Ref, b.Ref, a.Value != nil, b.Value != nil) {
+		return a
 	}
 
-	return &openapi3.LinkRef{Value: Link(a.Value, b.Value)}
+	return &openapi3.LinkRef{Value: m.Link(a.Value, b.Value)}
 }
 
-func Link(a, b *openapi3.Link) *openapi3.Link {
+func (m *Merger) Link(a, b *openapi3.Link) *openapi3.Link {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -519,31 +747,106 @@ func Link(a, b *openapi3.Link) *openapi3.Link {
 		return b
 	}
 
-	// TODO oh my god
+	server := a.Server
+	if server == nil {
+		server = b.Server
+	}
+	body := a.RequestBody
+	if body == nil {
+		body = b.RequestBody
+	} else if b.RequestBody != nil && !reflect.DeepEqual(body, b.RequestBody) {
+		m.conflict(ConflictValue, KeptA, "requestBody")
+	}
+
+	var params map[string]interface{}
+	m.in(func() { params = m.Extensions(a.Parameters, b.Parameters) }, "parameters")
+
 	return &openapi3.Link{
-		Extensions:   Extensions(a.Extensions, b.Extensions),
-		OperationRef: "",
-		OperationID:  "",
-		Description:  "",
-		Parameters:   nil,
-		Server:       nil,
-		RequestBody:  nil,
+		Extensions:   m.Extensions(a.Extensions, b.Extensions),
+		OperationRef: m.mergeString("operationRef", a.OperationRef, b.OperationRef),
+		OperationID:  m.mergeString("operationId", a.OperationID, b.OperationID),
+		Description:  m.mergeString("description", a.Description, b.Description),
+		Parameters:   params,
+		Server:       server,
+		RequestBody:  body,
 	}
 }
 
-func Callbacks(a, b openapi3.Callbacks) openapi3.Callbacks {
-	return a
+func (m *Merger) Callbacks(a, b openapi3.Callbacks) openapi3.Callbacks {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	if len(a) == 0 && len(b) != 0 {
+		return b
+	}
+	if len(a) != 0 && len(b) == 0 {
+		return a
+	}
+
+	rs := make(openapi3.Callbacks, max(len(a), len(b)))
+	for _, k := range sortedKeys(a) {
+		m.in(func() { rs[k] = m.CallbackRef(a[k], b[k]) }, k)
+	}
+	for k, v := range b {
+		if _, in := rs[k]; !in {
+			rs[k] = v
+		}
+	}
+	return rs
 }
 
-func Parameters(a, b openapi3.Parameters) openapi3.Parameters {
-	return a
+func (m *Merger) CallbackRef(a, b *openapi3.CallbackRef) *openapi3.CallbackRef {
+	if a == nil && b == nil {
+		return nil
+	}
+	if a != nil && b == nil {
+		return a
+	}
+	if a == nil && b != nil {
+		return b
+	}
+	if !m.resolvable(a.Ref, b.Ref, a.Value != nil, b.Value != nil) {
+		return a
+	}
+
+	// a callback is a set of paths by another name
+	v := openapi3.Callback(m.Paths(openapi3.Paths(*a.Value), openapi3.Paths(*b.Value)))
+	return &openapi3.CallbackRef{Value: &v}
 }
 
-func deprecated(a, b bool) bool {
-	return a || b
+// Parameters matches parameters up by where they are and their name. A parameter
+// only seen on one side can't be required, except in the path where it always is.
+func (m *Merger) Parameters(a, b openapi3.Parameters) openapi3.Parameters {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	bs := make(map[string]*openapi3.ParameterRef, len(b))
+	for _, p := range b {
+		bs[parameterKey(p)] = p
+	}
+
+	res := make(openapi3.Parameters, 0, len(a)+len(b))
+	seen := make(map[string]bool, len(a))
+	for i, p := range a {
+		k := parameterKey(p)
+		seen[k] = true
+		if q, in := bs[k]; in {
+			m.in(func() { res = append(res, m.ParameterRef(p, q)) }, strconv.Itoa(i))
+		} else {
+			res = append(res, optionalParameter(p))
+		}
+	}
+	for _, p := range b {
+		if !seen[parameterKey(p)] {
+			res = append(res, optionalParameter(p))
+		}
+	}
+
+	return res
 }
 
-func Security(a, b *openapi3.SecurityRequirements) *openapi3.SecurityRequirements {
+func (m *Merger) ParameterRef(a, b *openapi3.ParameterRef) *openapi3.ParameterRef {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -553,11 +856,32 @@ func Security(a, b *openapi3.SecurityRequirements) *openapi3.SecurityRequirement
 	if a == nil && b != nil {
 		return b
 	}
+	if !m.resolvable(a.Ref, b.Ref, a.Value != nil, b.Value != nil) {
+		return a
+	}
 
-	return a
+	return &openapi3.ParameterRef{Value: m.Parameter(a.Value, b.Value)}
 }
 
-func Servers(a, b *openapi3.Servers) *openapi3.Servers {
+func parameterKey(p *openapi3.ParameterRef) string {
+	if p.Value == nil {
+		return p.Ref
+	}
+	return p.Value.In + " " + p.Value.Name
+}
+
+func optionalParameter(p *openapi3.ParameterRef) *openapi3.ParameterRef {
+	if p.Value == nil || !p.Value.Required || p.Value.In == openapi3.ParameterInPath {
+		return p
+	}
+	v := *p.Value
+	v.Required = false
+	return &openapi3.ParameterRef{Value: &v}
+}
+
+// Security keeps every requirement either side had. Requirements are alternatives,
+// meeting any one of them is enough, so the union is what both sides allow.
+func (m *Merger) Security(a, b *openapi3.SecurityRequirements) *openapi3.SecurityRequirements {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -568,14 +892,107 @@ func Servers(a, b *openapi3.Servers) *openapi3.Servers {
 		return b
 	}
 
-	return a
+	res := append(openapi3.SecurityRequirements{}, *a...)
+	for _, r := range *b {
+		found := false
+		for _, s := range res {
+			if reflect.DeepEqual(r, s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, r)
+		}
+	}
+	return &res
 }
 
-func Tags(a, b openapi3.Tags) openapi3.Tags {
-	return a
+// Servers keeps every server either side had, matched up by url.
+func (m *Merger) Servers(a, b *openapi3.Servers) *openapi3.Servers {
+	if a == nil && b == nil {
+		return nil
+	}
+	if a != nil && b == nil {
+		return a
+	}
+	if a == nil && b != nil {
+		return b
+	}
+
+	res := append(openapi3.Servers{}, *a...)
+	for _, s := range *b {
+		i := 0
+		for i < len(res) && res[i].URL != s.URL {
+			i++
+		}
+		if i == len(res) {
+			res = append(res, s)
+			continue
+		}
+		m.in(func() {
+			res[i] = &openapi3.Server{
+				Extensions:  m.Extensions(res[i].Extensions, s.Extensions),
+				URL:         res[i].URL,
+				Description: m.mergeString("description", res[i].Description, s.Description),
+				Variables:   mergeServerVariables(res[i].Variables, s.Variables),
+			}
+		}, strconv.Itoa(i))
+	}
+	return &res
+}
+
+func mergeServerVariables(a, b map[string]*openapi3.ServerVariable) map[string]*openapi3.ServerVariable {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+
+	res := make(map[string]*openapi3.ServerVariable, len(a)+len(b))
+	for k, v := range b {
+		res[k] = v
+	}
+	for k, v := range a {
+		res[k] = v
+	}
+	return res
+}
+
+// Tags keeps every tag either side had, matched up by name.
+func (m *Merger) Tags(a, b openapi3.Tags) openapi3.Tags {
+	if len(b) == 0 {
+		return a
+	}
+	if len(a) == 0 {
+		return b
+	}
+
+	res := append(openapi3.Tags{}, a...)
+	for _, t := range b {
+		i := 0
+		for i < len(res) && res[i].Name != t.Name {
+			i++
+		}
+		if i == len(res) {
+			res = append(res, t)
+			continue
+		}
+		m.in(func() {
+			u := &openapi3.Tag{
+				Extensions:  m.Extensions(res[i].Extensions, t.Extensions),
+				Name:        res[i].Name,
+				Description: m.mergeString("description", res[i].Description, t.Description),
+			}
+			m.in(func() { u.ExternalDocs = m.ExternalDocs(res[i].ExternalDocs, t.ExternalDocs) }, "externalDocs")
+			res[i] = u
+		}, strconv.Itoa(i))
+	}
+	return res
 }
 
-func ExternalDocs(a, b *openapi3.ExternalDocs) *openapi3.ExternalDocs {
+func (m *Merger) ExternalDocs(a, b *openapi3.ExternalDocs) *openapi3.ExternalDocs {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -586,11 +1003,14 @@ func ExternalDocs(a, b *openapi3.ExternalDocs) *openapi3.ExternalDocs {
 		return b
 	}
 
-	// TODO
-	return a
+	return &openapi3.ExternalDocs{
+		Extensions:  m.Extensions(a.Extensions, b.Extensions),
+		Description: m.mergeString("description", a.Description, b.Description),
+		URL:         m.mergeString("url", a.URL, b.URL),
+	}
 }
 
-func SchemaRef(a, b *openapi3.SchemaRef) *openapi3.SchemaRef {
+func (m *Merger) SchemaRef(a, b *openapi3.SchemaRef) *openapi3.SchemaRef {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -600,18 +1020,14 @@ func SchemaRef(a, b *openapi3.SchemaRef) *openapi3.SchemaRef {
 	if a == nil && b != nil {
 		return b
 	}
-	// TODO needs to be able to follow refs
-	if a.Ref != "" || b.Ref != "" {
-		panic("need to handle this case")
-	}
-	if a.Value == nil || b.Value == nil {
-		panic("need to handle this case")
+	if !m.resolvable(a.Ref, b.Ref, a.Value != nil, b.Value != nil) {
+		return a
 	}
 
-	return Schema(a.Value, b.Value).NewRef()
+	return m.Schema(a.Value, b.Value).NewRef()
 }
 
-func Schema(a, b *openapi3.Schema) *openapi3.Schema {
+func (m *Merger) Schema(a, b *openapi3.Schema) *openapi3.Schema {
 	if a == nil && b == nil {
 		return nil
 	}
@@ -622,24 +1038,65 @@ func Schema(a, b *openapi3.Schema) *openapi3.Schema {
 		return b
 	}
 
-	if a.Type == b.Type {
-		return mergeSchemaSameType(a, b)
+	// null is the bottom of the lattice, it only ever makes the other side nullable
+	if isNull(a) && isNull(b) {
+		return a
+	}
+	if isNull(a) {
+		return withNullable(b)
+	}
+	if isNull(b) {
+		return withNullable(a)
+	}
+
+	if a.Type == b.Type && !hasBranches(a) && !hasBranches(b) {
+		return m.mergeSchemaSameType(a, b)
+	} else if isNumeric(a.Type) && isNumeric(b.Type) {
+		// an integer is just a number that hasn't had a fraction yet
+		s := m.mergeSchemaSameType(a, b)
+		s.Type = openapi3.TypeNumber
+		return s
 	} else {
-		return mergeSchemaDifferentType(a, b)
+		if a.Type != "" && b.Type != "" {
+			m.conflict(ConflictType, KeptBoth)
+		}
+		return m.mergeSchemaDifferentType(a, b)
 	}
 }
 
-func mergeSchemaSameType(a, b *openapi3.Schema) *openapi3.Schema {
-	return &openapi3.Schema{
-		Extensions:           Extensions(a.Extensions, b.Extensions),
-		OneOf:                mergeSchemaRefs(a.OneOf, b.OneOf),
-		AnyOf:                mergeSchemaRefs(a.AnyOf, b.AnyOf),
-		AllOf:                mergeSchemaRefs(a.AllOf, b.AllOf),
-		Not:                  SchemaRef(a.Not, b.Not),
+// isNull reports whether s is what a null sample infers, nullable and nothing else.
+func isNull(s *openapi3.Schema) bool {
+	return s.Type == "" && s.Nullable && len(s.OneOf) == 0 && len(s.AnyOf) == 0 && len(s.AllOf) == 0 && s.Not == nil
+}
+
+// hasBranches reports whether s is a oneOf or the like, those are merged branch by branch.
+func hasBranches(s *openapi3.Schema) bool {
+	return s.Type == "" && (len(s.OneOf) != 0 || len(s.AnyOf) != 0 || len(s.AllOf) != 0)
+}
+
+func withNullable(s *openapi3.Schema) *openapi3.Schema {
+	if s.Nullable {
+		return s
+	}
+	res := *s
+	res.Nullable = true
+	return &res
+}
+
+func isNumeric(t string) bool {
+	return t == openapi3.TypeInteger || t == openapi3.TypeNumber
+}
+
+func (m *Merger) mergeSchemaSameType(a, b *openapi3.Schema) *openapi3.Schema {
+	s := &openapi3.Schema{
+		Extensions:           m.Extensions(a.Extensions, b.Extensions),
+		OneOf:                m.mergeSchemaRefs("oneOf", a.OneOf, b.OneOf),
+		AnyOf:                m.mergeSchemaRefs("anyOf", a.AnyOf, b.AnyOf),
+		AllOf:                m.mergeSchemaRefs("allOf", a.AllOf, b.AllOf),
 		Type:                 a.Type,
-		Title:                mergeString(a.Title, b.Title),
-		Format:               mergeString(a.Format, b.Format),
-		Description:          mergeString(a.Description, b.Description),
+		Title:                m.mergeString("title", a.Title, b.Title),
+		Format:               m.mergeFormat(a.Format, b.Format),
+		Description:          m.mergeString("description", a.Description, b.Description),
 		Enum:                 nil,
 		Default:              nil,
 		Example:              nil,
@@ -652,59 +1109,95 @@ func mergeSchemaSameType(a, b *openapi3.Schema) *openapi3.Schema {
 		WriteOnly:            a.WriteOnly || b.WriteOnly,
 		AllowEmptyValue:      false,
 		Deprecated:           false,
-		XML:                  nil,
-		Min:                  nil,
-		Max:                  nil,
+		XML:                  m.mergeXML(a.XML, b.XML),
+		Min:                  mergeMin(a.Min, b.Min),
+		Max:                  mergeMax(a.Max, b.Max),
 		MultipleOf:           nil,
 		MinLength:            0,
 		MaxLength:            nil,
 		Pattern:              "",
 		MinItems:             0,
 		MaxItems:             nil,
-		Items:                SchemaRef(a.Items, b.Items),
 		Required:             mergeRequired(a.Required, b.Required),
-		Properties:           Schemas(a.Properties, b.Properties),
 		MinProps:             0,
 		MaxProps:             nil,
 		AdditionalProperties: openapi3.AdditionalProperties{},
 		Discriminator:        nil,
 	}
+	m.in(func() { s.Not = m.SchemaRef(a.Not, b.Not) }, "not")
+	m.in(func() { s.Items = m.SchemaRef(a.Items, b.Items) }, "items")
+	m.in(func() { s.Properties = m.Schemas(a.Properties, b.Properties) }, "properties")
+	mergeEnumTracking(s, a, b)
+	redactPII(s)
+	m.mergeMapProperties(s, a, b)
+	return s
 }
 
-func mergeSchemaRefs(a, b openapi3.SchemaRefs) openapi3.SchemaRefs {
+// mergeFormat keeps a format only if both sides agree on it, one sample that doesn't
+// fit means the format was a coincidence.
+func (m *Merger) mergeFormat(a, b string) string {
+	if (a == "int32" && b == "int64") || (a == "int64" && b == "int32") {
+		return "int64"
+	}
+	if a != b {
+		m.conflict(ConflictFormat, KeptNeither, "format")
+		return ""
+	}
 	return a
 }
 
-func mergeRequired(a, b []string) []string {
-	keep := make(map[string]bool, len(a))
-	for _, r := range a {
-		keep[r] = false
+// mergeMin and mergeMax widen the observed range. A side without one wasn't tracking
+// its values, so neither is the result.
+func mergeMin(a, b *float64) *float64 {
+	if a == nil || b == nil {
+		return nil
 	}
-	n := 0
-	for _, r := range b {
-		if _, in := keep[r]; in {
-			keep[r] = true
-			n += 1
-		}
+	v := math.Min(*a, *b)
+	return &v
+}
+
+func mergeMax(a, b *float64) *float64 {
+	if a == nil || b == nil {
+		return nil
 	}
+	v := math.Max(*a, *b)
+	return &v
+}
 
-	res := make([]string, n)
-	m := 0
-	for k, v := range keep {
-		if v {
-			res[m] = k
-			m += 1
-		}
+func (m *Merger) mergeXML(a, b *openapi3.XML) *openapi3.XML {
+	if a == nil {
+		return b
+	}
+	if b != nil && !reflect.DeepEqual(a, b) {
+		m.conflict(ConflictValue, KeptA, "xml")
 	}
+	return a
+}
 
-	if n != m {
-		panic("oh no")
+// mergeSchemaRefs keeps a's branches. A typed schema with branches didn't come from
+// traffic, there's no telling which of b's branches go with which of a's.
+func (m *Merger) mergeSchemaRefs(field string, a, b openapi3.SchemaRefs) openapi3.SchemaRefs {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) != 0 && !reflect.DeepEqual(a, b) {
+		m.conflict(ConflictValue, KeptA, field)
 	}
+	return a
+}
 
+// mergeRequired keeps what both sides require, in a's order.
+func mergeRequired(a, b []string) []string {
+	res := make([]string, 0, min(len(a), len(b)))
+	for _, r := range a {
+		if containsString(b, r) && !containsString(res, r) {
+			res = append(res, r)
+		}
+	}
 	return res
 }
 
-func Schemas(a, b openapi3.Schemas) openapi3.Schemas {
+func (m *Merger) Schemas(a, b openapi3.Schemas) openapi3.Schemas {
 	if len(a) == 0 && len(b) == 0 {
 		return openapi3.Schemas{}
 	}
@@ -718,12 +1211,12 @@ func Schemas(a, b openapi3.Schemas) openapi3.Schemas {
 	rs := make(openapi3.Schemas, max(len(a), len(b)))
 
 	visited := make(map[string]struct{}, len(a))
-	for k, v := range a {
+	for _, k := range sortedKeys(a) {
 		visited[k] = struct{}{}
 		if w, in := b[k]; in {
-			rs[k] = SchemaRef(v, w)
+			m.in(func() { rs[k] = m.SchemaRef(a[k], w) }, k)
 		} else {
-			rs[k] = v
+			rs[k] = a[k]
 		}
 	}
 
@@ -737,25 +1230,16 @@ func Schemas(a, b openapi3.Schemas) openapi3.Schemas {
 	return rs
 }
 
-func mergeSchemaDifferentType(a, b *openapi3.Schema) *openapi3.Schema {
+func (m *Merger) mergeSchemaDifferentType(a, b *openapi3.Schema) *openapi3.Schema {
 	af := flattenTypes(a)
 	bf := flattenTypes(b)
 
-	oneOf := mergeFlatParams(af.oneOf, bf.oneOf)
-	anyOf := mergeFlatParams(af.anyOf, bf.anyOf)
-	allOf := mergeFlatParams(af.allOf, bf.allOf)
-	not := SchemaRef(af.not, bf.not)
-
-	return &openapi3.Schema{
+	res := &openapi3.Schema{
 		Extensions:           nil,
-		OneOf:                oneOf,
-		AnyOf:                anyOf,
-		AllOf:                allOf,
-		Not:                  not,
 		Type:                 "",
-		Title:                mergeString(a.Title, b.Title),
-		Format:               mergeString(a.Format, b.Format),
-		Description:          mergeString(a.Description, b.Description),
+		Title:                m.mergeString("title", a.Title, b.Title),
+		Format:               "",
+		Description:          m.mergeString("description", a.Description, b.Description),
 		Enum:                 nil,
 		Default:              nil,
 		Example:              nil,
@@ -763,7 +1247,7 @@ func mergeSchemaDifferentType(a, b *openapi3.Schema) *openapi3.Schema {
 		UniqueItems:          false,
 		ExclusiveMin:         false,
 		ExclusiveMax:         false,
-		Nullable:             false,
+		Nullable:             a.Nullable || b.Nullable,
 		ReadOnly:             false,
 		WriteOnly:            false,
 		AllowEmptyValue:      false,
@@ -785,10 +1269,14 @@ func mergeSchemaDifferentType(a, b *openapi3.Schema) *openapi3.Schema {
 		AdditionalProperties: openapi3.AdditionalProperties{},
 		Discriminator:        nil,
 	}
+	m.in(func() { res.OneOf = m.mergeFlatParams(af.oneOf, bf.oneOf) }, "oneOf")
+	m.in(func() { res.AnyOf = m.mergeFlatParams(af.anyOf, bf.anyOf) }, "anyOf")
+	m.in(func() { res.AllOf = m.mergeFlatParams(af.allOf, bf.allOf) }, "allOf")
+	m.in(func() { res.Not = m.SchemaRef(af.not, bf.not) }, "not")
+	return res
 }
 
-func mergeFlatParams(a, b map[string]*openapi3.SchemaRef) []*openapi3.SchemaRef {
-	res := make([]*openapi3.SchemaRef, 0, max(len(a), len(b)))
+func (m *Merger) mergeFlatParams(a, b map[string]*openapi3.SchemaRef) []*openapi3.SchemaRef {
 	keys := make(map[string]struct{}, max(len(a), len(b)))
 	for k := range a {
 		keys[k] = struct{}{}
@@ -796,18 +1284,10 @@ func mergeFlatParams(a, b map[string]*openapi3.SchemaRef) []*openapi3.SchemaRef
 	for k := range b {
 		keys[k] = struct{}{}
 	}
-	for k := range keys {
-		var ra *openapi3.SchemaRef
-		if r, in := a[k]; in {
-			ra = r
-		}
 
-		var rb *openapi3.SchemaRef
-		if r, in := b[k]; in {
-			rb = r
-		}
-
-		res = append(res, SchemaRef(ra, rb))
+	res := make([]*openapi3.SchemaRef, 0, len(keys))
+	for i, k := range sortedKeys(keys) {
+		m.in(func() { res = append(res, m.SchemaRef(a[k], b[k])) }, strconv.Itoa(i))
 	}
 
 	return res
@@ -829,21 +1309,22 @@ func flattenTypes(s *openapi3.Schema) flat {
 			not:   nil,
 		}
 	} else {
+		// an untyped schema is only its branches, it isn't a branch itself
 		f := flat{
-			oneOf: map[string]*openapi3.SchemaRef{s.Type: s.NewRef()},
+			oneOf: map[string]*openapi3.SchemaRef{},
 			anyOf: map[string]*openapi3.SchemaRef{},
 			allOf: map[string]*openapi3.SchemaRef{},
 			not:   nil,
 		}
 
 		for _, v := range s.OneOf {
-			f.oneOf[v.Value.Type] = v
+			f.oneOf[branchKey(v)] = v
 		}
 		for _, v := range s.AnyOf {
-			f.anyOf[v.Value.Type] = v
+			f.anyOf[branchKey(v)] = v
 		}
 		for _, v := range s.AllOf {
-			f.allOf[v.Value.Type] = v
+			f.allOf[branchKey(v)] = v
 		}
 		f.not = s.Not
 
@@ -851,7 +1332,17 @@ func flattenTypes(s *openapi3.Schema) flat {
 	}
 }
 
-func mergeString(a, b string) string {
+// branchKey matches up the branches of a oneOf by their type, or by the component
+// they point at when that's all there is to go on.
+func branchKey(r *openapi3.SchemaRef) string {
+	if r.Value == nil {
+		return r.Ref
+	}
+	return r.Value.Type
+}
+
+// mergeString prefers whichever side has more to say.
+func (m *Merger) mergeString(field, a, b string) string {
 	if a == "" && b == "" {
 		return ""
 	}
@@ -861,8 +1352,22 @@ func mergeString(a, b string) string {
 	if a != "" && b == "" {
 		return a
 	}
+	if a == b {
+		return a
+	}
 	if len(b) > len(a) {
+		m.conflict(ConflictValue, KeptB, field)
 		return b
 	}
+	m.conflict(ConflictValue, KeptA, field)
 	return a
 }
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -20,3 +20,298 @@ func TestMergeWithTrivial(t *testing.T) {
 	docstr := string(bs)
 	assert.NotEmpty(t, docstr)
 }
+
+func queryParam(name string, s *openapi3.Schema) *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{Value: &openapi3.Parameter{
+		Name:     name,
+		In:       openapi3.ParameterInQuery,
+		Required: true,
+		Schema:   s.NewRef(),
+	}}
+}
+
+func TestMergeParameters(t *testing.T) {
+	var m Merger
+	a := openapi3.Parameters{
+		queryParam("page", &openapi3.Schema{Type: openapi3.TypeInteger}),
+		queryParam("sort", &openapi3.Schema{Type: openapi3.TypeString, Enum: []interface{}{"asc"}}),
+	}
+	b := openapi3.Parameters{
+		queryParam("sort", &openapi3.Schema{Type: openapi3.TypeString, Enum: []interface{}{"desc"}}),
+		queryParam("q", &openapi3.Schema{Type: openapi3.TypeString}),
+	}
+
+	res := m.Parameters(a, b)
+	assert.Len(t, res, 3)
+
+	byName := map[string]*openapi3.Parameter{}
+	for _, p := range res {
+		byName[p.Value.Name] = p.Value
+	}
+
+	assert.False(t, byName["page"].Required)
+	assert.False(t, byName["q"].Required)
+	assert.True(t, byName["sort"].Required)
+	assert.Equal(t, []interface{}{"asc", "desc"}, byName["sort"].Schema.Value.Enum)
+
+	// the inputs are left alone
+	assert.True(t, a[0].Value.Required)
+}
+
+func TestMergeParametersKeepsPathRequired(t *testing.T) {
+	var m Merger
+	a := openapi3.Parameters{{Value: &openapi3.Parameter{Name: "arg1", In: openapi3.ParameterInPath, Required: true}}}
+	res := m.Parameters(a, nil)
+	assert.True(t, res[0].Value.Required)
+}
+
+func TestMergeEnumCap(t *testing.T) {
+	var a []interface{}
+	for i := 0; i < MaxEnumValues; i++ {
+		a = append(a, i)
+	}
+	assert.Len(t, mergeEnum(a, []interface{}{0}), MaxEnumValues)
+	assert.Nil(t, mergeEnum(a, []interface{}{MaxEnumValues}))
+	assert.Nil(t, mergeEnum(a, nil))
+}
+
+func TestMergeEnumObservations(t *testing.T) {
+	var m Merger
+	sample := func(v string) *openapi3.Schema {
+		return &openapi3.Schema{Type: openapi3.TypeString, Extensions: NewEnumTracking(v)}
+	}
+
+	var s *openapi3.Schema
+	for i := 0; i < MinEnumObservations-1; i++ {
+		s = m.Schema(s, sample([]string{"active", "closed"}[i%2]))
+	}
+	assert.Nil(t, s.Enum)
+
+	s = m.Schema(s, sample("active"))
+	assert.Equal(t, []interface{}{"active", "closed"}, s.Enum)
+}
+
+func TestMergeEnumDemoted(t *testing.T) {
+	var m Merger
+	var s *openapi3.Schema
+	for i := 0; i <= MaxEnumValues; i++ {
+		s = m.Schema(s, &openapi3.Schema{Type: openapi3.TypeInteger, Extensions: NewEnumTracking(float64(i))})
+	}
+	assert.Nil(t, s.Enum)
+	assert.Nil(t, s.Extensions)
+
+	// once demoted, a field stays that way
+	s = m.Schema(s, &openapi3.Schema{Type: openapi3.TypeInteger, Extensions: NewEnumTracking(float64(0))})
+	assert.Nil(t, s.Enum)
+	assert.Nil(t, s.Extensions)
+}
+
+func TestMergeEnumJSON(t *testing.T) {
+	var m Merger
+	a := &openapi3.Schema{Type: openapi3.TypeString, Extensions: map[string]interface{}{
+		EnumValuesExtension:   []interface{}{"a"},
+		ObservationsExtension: float64(MinEnumObservations - 1),
+	}}
+	s := m.Schema(a, &openapi3.Schema{Type: openapi3.TypeString, Extensions: NewEnumTracking("b")})
+	assert.Equal(t, []interface{}{"a", "b"}, s.Enum)
+}
+
+func TestMergeRecordIntoMap(t *testing.T) {
+	var m Merger
+	record := &openapi3.Schema{
+		Type:       openapi3.TypeObject,
+		Properties: openapi3.Schemas{"alice": {Value: &openapi3.Schema{Type: openapi3.TypeInteger}}},
+		Required:   []string{"alice"},
+	}
+	mp := &openapi3.Schema{
+		Type:                 openapi3.TypeObject,
+		AdditionalProperties: openapi3.AdditionalProperties{Schema: &openapi3.SchemaRef{Value: &openapi3.Schema{Type: openapi3.TypeNumber}}},
+	}
+
+	for _, s := range []*openapi3.Schema{m.Schema(record, mp), m.Schema(mp, record)} {
+		assert.Empty(t, s.Properties)
+		assert.Empty(t, s.Required)
+		assert.Equal(t, openapi3.TypeNumber, s.AdditionalProperties.Schema.Value.Type)
+	}
+
+	empty := &openapi3.Schema{Type: openapi3.TypeObject}
+	assert.Equal(t, openapi3.TypeNumber, m.Schema(empty, mp).AdditionalProperties.Schema.Value.Type)
+}
+
+func TestMergeNull(t *testing.T) {
+	var m Merger
+	null := &openapi3.Schema{Nullable: true}
+	str := &openapi3.Schema{Type: openapi3.TypeString}
+
+	for _, s := range []*openapi3.Schema{m.Schema(null, str), m.Schema(str, null)} {
+		assert.Equal(t, openapi3.TypeString, s.Type)
+		assert.True(t, s.Nullable)
+		assert.Empty(t, s.OneOf)
+	}
+	assert.False(t, str.Nullable)
+
+	s := m.Schema(m.Schema(str, &openapi3.Schema{Type: openapi3.TypeBoolean}), null)
+	assert.True(t, s.Nullable)
+	assert.Len(t, s.OneOf, 2)
+	for _, o := range s.OneOf {
+		assert.NotEmpty(t, o.Value.Type)
+	}
+}
+
+func TestMergeSchemaRefs(t *testing.T) {
+	var m Merger
+	user := &openapi3.Schema{Type: openapi3.TypeObject, Properties: openapi3.Schemas{
+		"id": {Value: &openapi3.Schema{Type: openapi3.TypeInteger}},
+	}}
+	ref := &openapi3.SchemaRef{Ref: "#/components/schemas/User", Value: user}
+
+	assert.Same(t, ref, m.SchemaRef(ref, &openapi3.SchemaRef{Ref: ref.Ref, Value: user}))
+
+	// an inline schema merges with what the ref points at
+	inline := &openapi3.SchemaRef{Value: &openapi3.Schema{Type: openapi3.TypeObject, Properties: openapi3.Schemas{
+		"name": {Value: &openapi3.Schema{Type: openapi3.TypeString}},
+	}}}
+	s := m.SchemaRef(ref, inline)
+	assert.Equal(t, "", s.Ref)
+	assert.Len(t, s.Value.Properties, 2)
+
+	// a ref that was never resolved is kept as it is
+	unresolved := &openapi3.SchemaRef{Ref: "#/components/schemas/Other"}
+	assert.Same(t, unresolved, m.SchemaRef(unresolved, inline))
+}
+
+func TestMergeComponents(t *testing.T) {
+	var m Merger
+	a := &openapi3.Components{Schemas: openapi3.Schemas{
+		"User": {Value: &openapi3.Schema{Type: openapi3.TypeObject, Properties: openapi3.Schemas{
+			"id": {Value: &openapi3.Schema{Type: openapi3.TypeInteger}},
+		}}},
+	}}
+	b := &openapi3.Components{
+		Schemas: openapi3.Schemas{
+			"User": {Value: &openapi3.Schema{Type: openapi3.TypeObject, Properties: openapi3.Schemas{
+				"name": {Value: &openapi3.Schema{Type: openapi3.TypeString}},
+			}}},
+		},
+		Parameters: openapi3.ParametersMap{
+			"header.X-Tenant-Id": {Value: openapi3.NewHeaderParameter("X-Tenant-Id")},
+		},
+	}
+
+	c := m.Components(a, b)
+	assert.Len(t, c.Schemas["User"].Value.Properties, 2)
+	assert.Contains(t, c.Parameters, "header.X-Tenant-Id")
+}
+
+func TestMergeConflicts(t *testing.T) {
+	op := func(s *openapi3.Schema, desc string) *openapi3.T {
+		return &openapi3.T{Paths: openapi3.Paths{"/users": {Get: &openapi3.Operation{
+			Description: desc,
+			Responses: openapi3.Responses{"200": {Value: &openapi3.Response{
+				Content: openapi3.Content{"application/json": {Schema: s.NewRef()}},
+			}}},
+		}}}}
+	}
+	a := &openapi3.Schema{Type: openapi3.TypeObject, Properties: openapi3.Schemas{
+		"id":      {Value: &openapi3.Schema{Type: openapi3.TypeString, Format: "uuid"}},
+		"created": {Value: &openapi3.Schema{Type: openapi3.TypeString}},
+	}}
+	b := &openapi3.Schema{Type: openapi3.TypeObject, Properties: openapi3.Schemas{
+		"id":      {Value: &openapi3.Schema{Type: openapi3.TypeString}},
+		"created": {Value: &openapi3.Schema{Type: openapi3.TypeInteger}},
+	}}
+
+	var m Merger
+	m.Doc(op(a, "list users"), op(b, "lists every user"))
+
+	schema := "/paths/~1users/get/responses/200/content/application~1json/schema/properties"
+	assert.Equal(t, []Conflict{
+		{Path: "/paths/~1users/get/description", Kind: ConflictValue, Kept: KeptB},
+		{Path: schema + "/created", Kind: ConflictType, Kept: KeptBoth},
+		{Path: schema + "/id/format", Kind: ConflictFormat, Kept: KeptNeither},
+	}, m.Conflicts)
+}
+
+func TestMergeUnresolvedRef(t *testing.T) {
+	unresolved := &openapi3.ResponseRef{Ref: "#/components/responses/Missing"}
+	inline := &openapi3.ResponseRef{Value: openapi3.NewResponse()}
+
+	var m Merger
+	assert.NotPanics(t, func() {
+		assert.Same(t, unresolved, m.ResponseRef(unresolved, inline))
+		assert.Same(t, inline, m.ResponseRef(inline, unresolved))
+	})
+	assert.Len(t, m.Conflicts, 2)
+	assert.Equal(t, ConflictUnresolvedRef, m.Conflicts[0].Kind)
+
+	// branches that are only refs are told apart by the ref
+	s := m.Schema(
+		&openapi3.Schema{OneOf: openapi3.SchemaRefs{{Ref: "#/components/schemas/A"}}},
+		&openapi3.Schema{OneOf: openapi3.SchemaRefs{{Ref: "#/components/schemas/B"}}},
+	)
+	assert.Len(t, s.OneOf, 2)
+}
+
+func TestMergeRequestBodyNil(t *testing.T) {
+	body := openapi3.NewRequestBody().WithJSONSchema(openapi3.NewStringSchema())
+
+	var m Merger
+	assert.NotPanics(t, func() {
+		assert.Nil(t, m.RequestBody(nil, nil))
+		assert.Same(t, body, m.RequestBody(body, nil))
+		assert.Same(t, body, m.RequestBody(nil, body))
+	})
+	assert.Empty(t, m.Conflicts)
+}
+
+func TestMergeRequired(t *testing.T) {
+	assert.Equal(t, []string{"id", "name"}, mergeRequired([]string{"id", "name", "age"}, []string{"name", "id"}))
+	assert.Empty(t, mergeRequired(nil, []string{"id"}))
+}
+
+func TestMergeKeepsBothSides(t *testing.T) {
+	a := &openapi3.T{
+		Tags:     openapi3.Tags{{Name: "users"}},
+		Servers:  openapi3.Servers{{URL: "https://api.example.com"}},
+		Security: openapi3.SecurityRequirements{{"bearer": {}}},
+		Paths:    openapi3.Paths{},
+	}
+	b := &openapi3.T{
+		Tags:     openapi3.Tags{{Name: "users", Description: "people"}, {Name: "orders"}},
+		Servers:  openapi3.Servers{{URL: "https://api.example.com"}, {URL: "http://localhost"}},
+		Security: openapi3.SecurityRequirements{{"bearer": {}}, {"apiKey": {}}},
+		Paths:    openapi3.Paths{},
+	}
+
+	var m Merger
+	d := m.Doc(a, b)
+	assert.Len(t, d.Tags, 2)
+	assert.Equal(t, "people", d.Tags[0].Description)
+	assert.Len(t, d.Servers, 2)
+	assert.Len(t, d.Security, 2)
+	assert.Empty(t, m.Conflicts)
+
+	ea := openapi3.Examples{"one": {Value: openapi3.NewExample(1)}}
+	eb := openapi3.Examples{"one": {Value: openapi3.NewExample(2)}, "two": {Value: openapi3.NewExample(2)}}
+	es := m.Examples(ea, eb)
+	assert.Len(t, es, 2)
+	assert.Equal(t, 1, es["one"].Value.Value)
+	assert.Equal(t, []Conflict{{Path: "/one", Kind: ConflictValue, Kept: KeptA}}, m.Conflicts)
+}
+
+func TestMergePIIDropsValues(t *testing.T) {
+	var m Merger
+	a := &openapi3.Schema{Type: openapi3.TypeString, Enum: []interface{}{"a@example.com"}, Example: "a@example.com"}
+	b := &openapi3.Schema{Type: openapi3.TypeString, Extensions: map[string]interface{}{PIIExtension: "email"}}
+
+	s := m.Schema(a, b)
+	assert.Equal(t, "email", s.Extensions[PIIExtension])
+	assert.Nil(t, s.Enum)
+	assert.Nil(t, s.Example)
+
+	pa := &openapi3.Parameter{Name: "email", In: openapi3.ParameterInQuery, Schema: a.NewRef(), Example: "a@example.com"}
+	pb := &openapi3.Parameter{Name: "email", In: openapi3.ParameterInQuery, Schema: b.NewRef()}
+	p := m.Parameter(pa, pb)
+	assert.Nil(t, p.Example)
+	assert.Nil(t, p.Schema.Value.Enum)
+}
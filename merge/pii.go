@@ -0,0 +1,24 @@
+package merge
+
+import "github.com/getkin/kin-openapi/openapi3"
+
+// PIIExtension marks a field where a sample looked like personal data or a credential,
+// its value is what kind, like "email". Once a field is marked it stays that way, and
+// no enum or example is ever kept for it.
+const PIIExtension = "x-siege-pii"
+
+func isPII(s *openapi3.Schema) bool {
+	_, in := s.Extensions[PIIExtension]
+	return in
+}
+
+// redactPII drops the values kept for s, the merge of two schemas, if it holds PII.
+func redactPII(s *openapi3.Schema) {
+	if !isPII(s) {
+		return
+	}
+	StopEnumTracking(s)
+	s.Enum = nil
+	s.Example = nil
+	s.Default = nil
+}
@@ -0,0 +1,139 @@
+package pathtemplate
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/google/uuid"
+)
+
+// Classifier decides whether a path segment is a value rather than part of the route.
+type Classifier interface {
+	// Classify returns the schema of segment if it is a value. The suffix is added to
+	// the parameter name, e.g. "Id" for /users/{userId}.
+	Classify(segment string) (schema *openapi3.Schema, suffix string, ok bool)
+}
+
+// ClassifierFunc lets a plain function be used as a Classifier.
+type ClassifierFunc func(segment string) (*openapi3.Schema, string, bool)
+
+func (f ClassifierFunc) Classify(segment string) (*openapi3.Schema, string, bool) {
+	return f(segment)
+}
+
+// DefaultClassifiers are tried in order, the more specific ones first.
+func DefaultClassifiers() []Classifier {
+	return []Classifier{
+		ClassifierFunc(classifyInteger),
+		ClassifierFunc(classifyUUID),
+		ClassifierFunc(classifyDate),
+		ClassifierFunc(classifyEmail),
+		ClassifierFunc(classifyULID),
+		ClassifierFunc(classifyHex),
+		ClassifierFunc(classifyKSUID),
+		ClassifierFunc(classifyBase64),
+	}
+}
+
+var (
+	ulidPattern   = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Za-hjkmnp-tv-z]{25}$`)
+	hexPattern    = regexp.MustCompile(`^[0-9a-fA-F]{8,}$`)
+	ksuidPattern  = regexp.MustCompile(`^[0-9A-Za-z]{27}$`)
+	base64Pattern = regexp.MustCompile(`^[A-Za-z0-9_+-]{16,}={0,2}$`)
+	// slugPattern matches lowercase words joined by - or _, each with at most a number
+	// stuck to either end, like ec2-instance-types or oauth2-authorization
+	slugPattern   = regexp.MustCompile(`^(?:[0-9]*[a-z]+[0-9]*|[0-9]+)(?:[_-](?:[0-9]*[a-z]+[0-9]*|[0-9]+))+$`)
+	digitPattern  = regexp.MustCompile(`[0-9]`)
+	letterPattern = regexp.MustCompile(`[A-Za-z]`)
+)
+
+func classifyInteger(s string) (*openapi3.Schema, string, bool) {
+	if _, err := strconv.ParseUint(s, 10, 64); err != nil {
+		return nil, "", false
+	}
+	return &openapi3.Schema{Type: openapi3.TypeInteger}, "Id", true
+}
+
+func classifyUUID(s string) (*openapi3.Schema, string, bool) {
+	if _, err := uuid.Parse(s); err != nil {
+		return nil, "", false
+	}
+	return &openapi3.Schema{Type: openapi3.TypeString, Format: "uuid"}, "Id", true
+}
+
+func classifyDate(s string) (*openapi3.Schema, string, bool) {
+	if _, err := time.Parse(time.DateOnly, s); err == nil {
+		return &openapi3.Schema{Type: openapi3.TypeString, Format: "date"}, "Date", true
+	}
+	if _, err := time.Parse(time.RFC3339, s); err == nil {
+		return &openapi3.Schema{Type: openapi3.TypeString, Format: "date-time"}, "Date", true
+	}
+	return nil, "", false
+}
+
+func classifyEmail(s string) (*openapi3.Schema, string, bool) {
+	a, err := mail.ParseAddress(s)
+	if err != nil || a.Address != s {
+		return nil, "", false
+	}
+	return &openapi3.Schema{Type: openapi3.TypeString, Format: "email"}, "Email", true
+}
+
+// classifyULID matches ULIDs, 26 characters of Crockford's base32.
+func classifyULID(s string) (*openapi3.Schema, string, bool) {
+	if !ulidPattern.MatchString(s) || !isMixed(s) {
+		return nil, "", false
+	}
+	return openapi3.NewStringSchema(), "Id", true
+}
+
+// classifyHex matches hex ids like Mongo's ObjectIDs and hashes. Requiring a digit
+// keeps words made only of a to f, like "facade", out.
+func classifyHex(s string) (*openapi3.Schema, string, bool) {
+	if !hexPattern.MatchString(s) || !digitPattern.MatchString(s) {
+		return nil, "", false
+	}
+	return openapi3.NewStringSchema(), "Id", true
+}
+
+// classifyKSUID matches KSUIDs, 27 characters of base62.
+func classifyKSUID(s string) (*openapi3.Schema, string, bool) {
+	if !ksuidPattern.MatchString(s) || !isMixed(s) {
+		return nil, "", false
+	}
+	return openapi3.NewStringSchema(), "Id", true
+}
+
+// classifyBase64 matches long opaque tokens, base64 in either alphabet. The url safe
+// alphabet has - and _, so slugs made of words have to be kept out.
+func classifyBase64(s string) (*openapi3.Schema, string, bool) {
+	if !base64Pattern.MatchString(s) || !isMixed(s) || slugPattern.MatchString(s) {
+		return nil, "", false
+	}
+	return openapi3.NewStringSchema(), "Token", true
+}
+
+// isMixed reports whether s has both digits and letters, which words and slugs
+// almost never do.
+func isMixed(s string) bool {
+	return digitPattern.MatchString(s) && letterPattern.MatchString(s)
+}
+
+// NewRegexClassifier matches whole segments against a user supplied pattern, for
+// things like SKUs that only make sense for one API.
+func NewRegexClassifier(pattern string) (Classifier, error) {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("bad path pattern %q: %w", pattern, err)
+	}
+	return ClassifierFunc(func(s string) (*openapi3.Schema, string, bool) {
+		if !re.MatchString(s) {
+			return nil, "", false
+		}
+		return openapi3.NewStringSchema(), "Id", true
+	}), nil
+}
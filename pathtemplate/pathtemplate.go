@@ -0,0 +1,154 @@
+// Package pathtemplate turns concrete request paths like /users/42 into templates like
+// /users/{userId}.
+package pathtemplate
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+type Templater struct {
+	classifiers []Classifier
+}
+
+// New returns a Templater that tries each of the classifiers in order on every segment.
+func New(classifiers ...Classifier) *Templater {
+	return &Templater{classifiers: classifiers}
+}
+
+// Template replaces the segments of path that look like values with parameters.
+func (t *Templater) Template(path string) (string, openapi3.Parameters) {
+	var params openapi3.Parameters
+	names := make(map[string]int)
+
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if p == "" {
+			continue
+		}
+
+		schema, suffix, ok := t.classify(p)
+		if !ok {
+			continue
+		}
+
+		prev := ""
+		if i > 0 && !isTemplated(parts[i-1]) {
+			prev = parts[i-1]
+		}
+		name := uniqueName(names, parameterName(prev, suffix, len(params)+1))
+
+		parts[i] = "{" + name + "}"
+		params = append(params, &openapi3.ParameterRef{Value: &openapi3.Parameter{
+			Name:     name,
+			In:       openapi3.ParameterInPath,
+			Required: true,
+			Schema:   schema.NewRef(),
+		}})
+	}
+
+	return strings.Join(parts, "/"), params
+}
+
+func (t *Templater) classify(segment string) (*openapi3.Schema, string, bool) {
+	for _, c := range t.classifiers {
+		if s, suffix, ok := c.Classify(segment); ok {
+			return s, suffix, true
+		}
+	}
+	return nil, "", false
+}
+
+func isTemplated(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// parameterName names a parameter after the collection it's in, /orders/{orderId}. A
+// value with nothing useful in front of it falls back to its position, {arg1}.
+func parameterName(prev, suffix string, n int) string {
+	words := splitWords(prev)
+	if len(words) == 0 {
+		return fmt.Sprintf("arg%d", n)
+	}
+
+	words[len(words)-1] = singular(words[len(words)-1])
+	var b strings.Builder
+	b.WriteString(strings.ToLower(words[0]))
+	for _, w := range words[1:] {
+		b.WriteString(title(w))
+	}
+	b.WriteString(suffix)
+	return b.String()
+}
+
+// TypeName turns a collection or field name into the name of the type of one of its
+// values, "line_items" is a LineItem.
+func TypeName(s string) string {
+	words := splitWords(s)
+	if len(words) == 0 {
+		return ""
+	}
+
+	words[len(words)-1] = singular(words[len(words)-1])
+	var b strings.Builder
+	for _, w := range words {
+		b.WriteString(title(w))
+	}
+	return b.String()
+}
+
+func uniqueName(names map[string]int, name string) string {
+	names[name]++
+	if n := names[name]; n > 1 {
+		return fmt.Sprintf("%s%d", name, n)
+	}
+	return name
+}
+
+// splitWords breaks a segment like "order-items" or "line_items" into words, dropping
+// anything that can't go in a parameter name.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// singular is a rough English singular, good enough for collection names.
+func singular(w string) string {
+	lw := strings.ToLower(w)
+	switch {
+	case strings.HasSuffix(lw, "ies") && len(w) > 3:
+		return w[:len(w)-3] + "y"
+	case strings.HasSuffix(lw, "sses"), strings.HasSuffix(lw, "uses"), strings.HasSuffix(lw, "xes"), strings.HasSuffix(lw, "ches"), strings.HasSuffix(lw, "shes"):
+		return w[:len(w)-2]
+	case strings.HasSuffix(lw, "ss"), strings.HasSuffix(lw, "us"):
+		return w
+	case strings.HasSuffix(lw, "s") && len(w) > 1:
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+func title(w string) string {
+	if w == "" {
+		return w
+	}
+	return strings.ToUpper(w[:1]) + strings.ToLower(w[1:])
+}
+
+// Parameter describes the path parameter name given one of its values.
+func (t *Templater) Parameter(name, value string) *openapi3.ParameterRef {
+	schema, _, ok := t.classify(value)
+	if !ok {
+		schema = openapi3.NewStringSchema()
+	}
+	return &openapi3.ParameterRef{Value: &openapi3.Parameter{
+		Name:     name,
+		In:       openapi3.ParameterInPath,
+		Required: true,
+		Schema:   schema.NewRef(),
+	}}
+}
@@ -0,0 +1,79 @@
+package pathtemplate
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate(t *testing.T) {
+	tr := New(DefaultClassifiers()...)
+
+	cases := map[string]string{
+		"/users/42": "/users/{userId}",
+		"/users/42/orders/5f2b6c1e9d3a4b0012345678": "/users/{userId}/orders/{orderId}",
+		"/files/abc123def":                          "/files/{fileId}",
+		"/reports/2023-10-01":                       "/reports/{reportDate}",
+		"/users/alice@example.com":                  "/users/{userEmail}",
+		"/events/01ARZ3NDEKTSV4RRFFQ69G5FAV":        "/events/{eventId}",
+		"/line-items/0ujsswThIGTUYm2K8FjOOfXtY1K":   "/line-items/{lineItemId}",
+		"/categories/7":                             "/categories/{categoryId}",
+		"/addresses/7":                              "/addresses/{addressId}",
+		"/share/aGVsbG8gd29ybGQhIQ":                 "/share/{shareToken}",
+		"/42/42":                                    "/{arg1}/{arg2}",
+		"/users/alice":                              "/users/alice",
+		"/api/v1/facade":                            "/api/v1/facade",
+		"/ec2-instance-types":                       "/ec2-instance-types",
+		"/oauth2-authorization":                     "/oauth2-authorization",
+		"/v2/s3_bucket_policies":                    "/v2/s3_bucket_policies",
+		"/share/aGVsbG8-d29ybGQ_IQ":                 "/share/{shareToken}",
+		"/":                                         "/",
+		"/items/5d2d5c5e-6f9c-4b3b-8b8a-1c2d3e4f5a6b/tags": "/items/{itemId}/tags",
+	}
+	for path, want := range cases {
+		got, _ := tr.Template(path)
+		assert.Equal(t, want, got, path)
+	}
+}
+
+func TestTemplateParameters(t *testing.T) {
+	tr := New(DefaultClassifiers()...)
+
+	_, ps := tr.Template("/users/42/friends/550e8400-e29b-41d4-a716-446655440000")
+	assert.Len(t, ps, 2)
+	assert.Equal(t, "userId", ps[0].Value.Name)
+	assert.Equal(t, openapi3.ParameterInPath, ps[0].Value.In)
+	assert.True(t, ps[0].Value.Required)
+	assert.Equal(t, openapi3.TypeInteger, ps[0].Value.Schema.Value.Type)
+	assert.Equal(t, "friendId", ps[1].Value.Name)
+	assert.Equal(t, "uuid", ps[1].Value.Schema.Value.Format)
+}
+
+func TestTemplateDuplicateNames(t *testing.T) {
+	tr := New(DefaultClassifiers()...)
+
+	got, _ := tr.Template("/users/1/users/2")
+	assert.Equal(t, "/users/{userId}/users/{userId2}", got)
+}
+
+func TestRegexClassifier(t *testing.T) {
+	c, err := NewRegexClassifier(`SKU-[0-9]+`)
+	assert.Nil(t, err)
+
+	tr := New(c)
+	got, _ := tr.Template("/products/SKU-123")
+	assert.Equal(t, "/products/{productId}", got)
+	got, _ = tr.Template("/products/SKU-123x")
+	assert.Equal(t, "/products/SKU-123x", got)
+
+	_, err = NewRegexClassifier(`(`)
+	assert.NotNil(t, err)
+}
+
+func TestTypeName(t *testing.T) {
+	assert.Equal(t, "User", TypeName("users"))
+	assert.Equal(t, "LineItem", TypeName("line_items"))
+	assert.Equal(t, "Address", TypeName("address"))
+	assert.Equal(t, "", TypeName("-"))
+}
@@ -0,0 +1,107 @@
+package pathtemplate
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Spec matches paths against the templates of an existing document, so traffic is
+// attributed the way the people who wrote the API think of it.
+type Spec struct {
+	templates []specTemplate
+	// prefixes are the paths of the document's servers, which its templates are
+	// relative to, longest first
+	prefixes []string
+}
+
+type specTemplate struct {
+	template string
+	parts    []string
+}
+
+func NewSpec(paths openapi3.Paths, servers openapi3.Servers) *Spec {
+	s := &Spec{}
+	for _, server := range servers {
+		bp, err := server.BasePath()
+		if err != nil {
+			continue
+		}
+		if bp = strings.TrimRight(bp, "/"); bp != "" {
+			s.prefixes = append(s.prefixes, bp)
+		}
+	}
+	sort.Slice(s.prefixes, func(i, j int) bool {
+		return len(s.prefixes[i]) > len(s.prefixes[j])
+	})
+
+	for template := range paths {
+		s.templates = append(s.templates, specTemplate{template: template, parts: strings.Split(template, "/")})
+	}
+
+	// /users/me has to win over /users/{userId}, so try the templates with literals
+	// earliest in the path first
+	sort.Slice(s.templates, func(i, j int) bool {
+		return moreSpecific(s.templates[i].parts, s.templates[j].parts)
+	})
+	return s
+}
+
+func moreSpecific(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		at, bt := isTemplated(a[i]), isTemplated(b[i])
+		if at != bt {
+			return bt
+		}
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return strings.Join(a, "/") < strings.Join(b, "/")
+}
+
+// Match returns the documented template for path and the value of each of its
+// parameters. The path of a server it's under is stripped first, one that isn't under
+// any is matched as it is, a proxy may have stripped it already.
+func (s *Spec) Match(path string) (string, map[string]string, bool) {
+	for _, prefix := range s.prefixes {
+		if rest, ok := strings.CutPrefix(path, prefix); ok && strings.HasPrefix(rest, "/") {
+			if template, values, ok := s.match(rest); ok {
+				return template, values, true
+			}
+		}
+	}
+	return s.match(path)
+}
+
+func (s *Spec) match(path string) (string, map[string]string, bool) {
+	parts := strings.Split(path, "/")
+	for _, t := range s.templates {
+		if values, ok := t.match(parts); ok {
+			return t.template, values, true
+		}
+	}
+	return "", nil, false
+}
+
+func (t *specTemplate) match(parts []string) (map[string]string, bool) {
+	if len(parts) != len(t.parts) {
+		return nil, false
+	}
+
+	values := make(map[string]string)
+	for i, p := range t.parts {
+		if isTemplated(p) {
+			if parts[i] == "" {
+				return nil, false
+			}
+			values[strings.Trim(p, "{}")] = parts[i]
+			continue
+		}
+		if p != parts[i] {
+			return nil, false
+		}
+	}
+	return values, true
+}
@@ -0,0 +1,62 @@
+package pathtemplate
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecMatch(t *testing.T) {
+	s := NewSpec(openapi3.Paths{
+		"/users/{id}":       &openapi3.PathItem{},
+		"/users/me":         &openapi3.PathItem{},
+		"/users/{id}/posts": &openapi3.PathItem{},
+	}, nil)
+
+	template, values, ok := s.Match("/users/alice")
+	assert.True(t, ok)
+	assert.Equal(t, "/users/{id}", template)
+	assert.Equal(t, map[string]string{"id": "alice"}, values)
+
+	template, _, ok = s.Match("/users/me")
+	assert.True(t, ok)
+	assert.Equal(t, "/users/me", template)
+
+	template, _, ok = s.Match("/users/7/posts")
+	assert.True(t, ok)
+	assert.Equal(t, "/users/{id}/posts", template)
+
+	_, _, ok = s.Match("/users/")
+	assert.False(t, ok)
+	_, _, ok = s.Match("/orders/7")
+	assert.False(t, ok)
+}
+
+func TestSpecMatchServerPath(t *testing.T) {
+	s := NewSpec(openapi3.Paths{
+		"/users/{id}": &openapi3.PathItem{},
+	}, openapi3.Servers{
+		{URL: "https://api.example.com/x/v1"},
+		{URL: "https://{host}/{version}/", Variables: map[string]*openapi3.ServerVariable{
+			"host":    {Default: "api.example.com"},
+			"version": {Default: "v2"},
+		}},
+	})
+
+	template, values, ok := s.Match("/x/v1/users/alice")
+	assert.True(t, ok)
+	assert.Equal(t, "/users/{id}", template)
+	assert.Equal(t, map[string]string{"id": "alice"}, values)
+
+	template, _, ok = s.Match("/v2/users/bob")
+	assert.True(t, ok)
+	assert.Equal(t, "/users/{id}", template)
+
+	_, _, ok = s.Match("/users/alice")
+	assert.True(t, ok)
+	_, _, ok = s.Match("/x/v1users/alice")
+	assert.False(t, ok)
+	_, _, ok = s.Match("/x/v2/users/alice")
+	assert.False(t, ok)
+}
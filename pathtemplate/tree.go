@@ -0,0 +1,185 @@
+package pathtemplate
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// DefaultMaxSiblings is how many values of the same shape can sit side by side in a
+// path before we decide they're a parameter.
+const DefaultMaxSiblings = 50
+
+// Tree is a prefix tree of every path seen so far. The classifiers only see one
+// segment at a time so they can't tell /users/alice from /users/settings, the tree
+// spots the position that keeps taking new values and collapses them into a parameter.
+type Tree struct {
+	MaxSiblings int
+	root        *treeNode
+}
+
+type treeNode struct {
+	children map[string]*treeNode
+	// params maps a shape of segment to the parameter that replaced it
+	params map[string]string
+}
+
+func newTreeNode() *treeNode {
+	return &treeNode{children: make(map[string]*treeNode), params: make(map[string]string)}
+}
+
+func NewTree(maxSiblings int) *Tree {
+	return &Tree{MaxSiblings: maxSiblings, root: newTreeNode()}
+}
+
+// Insert adds path to the tree and returns its template, along with the parameters
+// the tree introduced. Collapsed reports whether adding path turned some segments into
+// a parameter, paths inserted before may have a new template now, see Lookup.
+func (t *Tree) Insert(path string) (template string, params openapi3.Parameters, collapsed bool) {
+	parts := strings.Split(path, "/")
+	names := make(map[string]int)
+
+	n := t.root
+	for i, s := range parts {
+		if isTemplated(s) {
+			names[strings.Trim(s, "{}")]++
+		}
+		if s == "" || isTemplated(s) {
+			n = n.child(s)
+			continue
+		}
+
+		shape := shapeOf(s)
+		if p, in := n.params[shape]; in {
+			parts[i] = p
+			params = append(params, newTreeParameter(p))
+			n = n.child(p)
+			continue
+		}
+
+		n.child(s)
+		if n.countShape(shape) <= t.MaxSiblings {
+			n = n.children[s]
+			continue
+		}
+
+		prev := ""
+		if i > 0 && !isTemplated(parts[i-1]) {
+			prev = parts[i-1]
+		}
+		p := "{" + uniqueName(names, parameterName(prev, "Id", len(names)+1)) + "}"
+		n.collapse(shape, p)
+
+		parts[i] = p
+		params = append(params, newTreeParameter(p))
+		collapsed = true
+		n = n.children[p]
+	}
+
+	return strings.Join(parts, "/"), params, collapsed
+}
+
+// Lookup returns the current template for a path inserted earlier, along with the
+// parameters the tree introduced.
+func (t *Tree) Lookup(path string) (string, openapi3.Parameters) {
+	parts := strings.Split(path, "/")
+	var params openapi3.Parameters
+
+	n := t.root
+	for i, s := range parts {
+		if n == nil {
+			break
+		}
+		if c, in := n.children[s]; in {
+			n = c
+			continue
+		}
+		if p, in := n.params[shapeOf(s)]; in && !isTemplated(s) {
+			parts[i] = p
+			params = append(params, newTreeParameter(p))
+			n = n.children[p]
+			continue
+		}
+		n = nil
+	}
+
+	return strings.Join(parts, "/"), params
+}
+
+func (n *treeNode) child(s string) *treeNode {
+	c, in := n.children[s]
+	if !in {
+		c = newTreeNode()
+		n.children[s] = c
+	}
+	return c
+}
+
+func (n *treeNode) countShape(shape string) int {
+	count := 0
+	for s := range n.children {
+		if !isTemplated(s) && shapeOf(s) == shape {
+			count++
+		}
+	}
+	return count
+}
+
+// collapse folds every child with the given shape into a parameter p.
+func (n *treeNode) collapse(shape, p string) {
+	n.params[shape] = p
+	into := n.child(p)
+	for s, c := range n.children {
+		if isTemplated(s) || shapeOf(s) != shape {
+			continue
+		}
+		into.absorb(c)
+		delete(n.children, s)
+	}
+}
+
+func (n *treeNode) absorb(o *treeNode) {
+	for s, c := range o.children {
+		if mine, in := n.children[s]; in {
+			mine.absorb(c)
+		} else {
+			n.children[s] = c
+		}
+	}
+	for shape, p := range o.params {
+		if _, in := n.params[shape]; !in {
+			n.params[shape] = p
+		}
+	}
+}
+
+// shapeOf describes what a segment looks like rather than what it says, "alice" and
+// "bob" have the same shape, "alice-smith" and "v2" don't.
+func shapeOf(s string) string {
+	var b strings.Builder
+	var last rune
+	for _, r := range s {
+		c := r
+		switch {
+		case unicode.IsLetter(r):
+			c = 'a'
+		case unicode.IsDigit(r):
+			c = '9'
+		}
+		if c != last {
+			b.WriteRune(c)
+			last = c
+		}
+	}
+	return b.String()
+}
+
+func newTreeParameter(p string) *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{Value: &openapi3.Parameter{
+		Name:     strings.Trim(p, "{}"),
+		In:       openapi3.ParameterInPath,
+		Required: true,
+		Schema:   openapi3.NewStringSchema().NewRef(),
+	}}
+}
@@ -0,0 +1,64 @@
+package pathtemplate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeCollapsesSiblings(t *testing.T) {
+	tr := NewTree(3)
+
+	names := []string{"alice", "bob", "carol"}
+	for _, n := range names {
+		path, params, collapsed := tr.Insert("/users/" + n + "/posts")
+		assert.Equal(t, "/users/"+n+"/posts", path)
+		assert.Empty(t, params)
+		assert.False(t, collapsed)
+	}
+
+	path, params, collapsed := tr.Insert("/users/dave/posts")
+	assert.Equal(t, "/users/{userId}/posts", path)
+	assert.True(t, collapsed)
+	assert.Len(t, params, 1)
+	assert.Equal(t, "userId", params[0].Value.Name)
+
+	// the paths seen before the collapse map onto the template now
+	for _, n := range names {
+		path, _ := tr.Lookup("/users/" + n + "/posts")
+		assert.Equal(t, "/users/{userId}/posts", path)
+	}
+
+	// and new values go straight to it
+	path, _, collapsed = tr.Insert("/users/erin/posts")
+	assert.Equal(t, "/users/{userId}/posts", path)
+	assert.False(t, collapsed)
+}
+
+func TestTreeKeepsOtherShapes(t *testing.T) {
+	tr := NewTree(3)
+	for i := 0; i < 5; i++ {
+		tr.Insert(fmt.Sprintf("/users/%c%c", 'a'+i, 'a'+i))
+	}
+	tr.Insert("/users/me-too")
+
+	path, _ := tr.Lookup("/users/me-too")
+	assert.Equal(t, "/users/me-too", path)
+	path, _ = tr.Lookup("/users/zz")
+	assert.Equal(t, "/users/{userId}", path)
+}
+
+func TestTreeLeavesTemplatesAlone(t *testing.T) {
+	tr := NewTree(1)
+	path, _, _ := tr.Insert("/users/{userId}")
+	assert.Equal(t, "/users/{userId}", path)
+	path, _, _ = tr.Insert("/users/{userId}/posts")
+	assert.Equal(t, "/users/{userId}/posts", path)
+}
+
+func TestShapeOf(t *testing.T) {
+	assert.Equal(t, "a", shapeOf("alice"))
+	assert.Equal(t, "a-a", shapeOf("alice-smith"))
+	assert.Equal(t, "a9", shapeOf("v2"))
+}